@@ -1,10 +1,12 @@
 package igin
 
 import (
+	"context"
 	"html/template"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
 	"github.com/go-playground/validator/v10"
 )
 
@@ -18,10 +20,22 @@ type IPlugin interface {
 	RouterPath() string
 }
 
+// IMiddleware is implemented by controllers and plugins declaring middleware for all their routes.
+// It runs after the engine middleware and before the middleware the controller or plugin registers itself.
+type IMiddleware interface {
+	Middleware() []gin.HandlerFunc
+}
+
 type Engine struct {
 	*gin.Engine
+	contextFuncs  map[string]ContextFunc
+	pre           []gin.HandlerFunc
+	plugins       []*installedPlugin
+	pluginsConfig PluginsConfig
 }
 
+type preRoutedKey struct{}
+
 func Default() *Engine {
 	return NewEngine(gin.Default())
 }
@@ -43,34 +57,113 @@ func (e *Engine) BindingValidatorEngine(locale string, translators ...*translato
 		_, _ = Translator.UtTranslator(v, locale)
 	}
 }
+
+// SetFuncMaps merges funcMaps into the template functions, later maps override earlier ones.
+// Call it before loading templates and registering routes, ContextFunc values are bound to the rendering request.
 func (e *Engine) SetFuncMaps(funcMaps ...template.FuncMap) *Engine {
-	funcMaps = append(funcMaps, defaultTemplateFuncMaps)
+	merged := template.FuncMap{}
+	for name, fn := range defaultTemplateFuncMaps {
+		merged[name] = fn
+	}
+	for name, fn := range e.FuncMap {
+		merged[name] = fn
+	}
 	for _, funcMap := range funcMaps {
-		e.SetFuncMap(funcMap)
+		for name, fn := range funcMap {
+			merged[name] = fn
+			if contextFunc, ok := fn.(ContextFunc); ok {
+				if e.contextFuncs == nil {
+					e.contextFuncs = map[string]ContextFunc{}
+					e.Use(contextWriterNext)
+				}
+				e.contextFuncs[name] = contextFunc
+			}
+		}
 	}
+	e.SetFuncMap(merged)
 	return e
 }
+
+// LoadHTMLGlob gin.Engine.LoadHTMLGlob with support for ContextFunc.
+func (e *Engine) LoadHTMLGlob(pattern string) {
+	e.Engine.LoadHTMLGlob(pattern)
+	e.wrapHTMLRender()
+}
+
+// LoadHTMLFiles gin.Engine.LoadHTMLFiles with support for ContextFunc.
+func (e *Engine) LoadHTMLFiles(files ...string) {
+	e.Engine.LoadHTMLFiles(files...)
+	e.wrapHTMLRender()
+}
+
+// SetHTMLTemplate gin.Engine.SetHTMLTemplate with support for ContextFunc.
+func (e *Engine) SetHTMLTemplate(templ *template.Template) {
+	e.Engine.SetHTMLTemplate(templ)
+	e.wrapHTMLRender()
+}
+
+func (e *Engine) wrapHTMLRender() {
+	if len(e.contextFuncs) == 0 {
+		return
+	}
+	r := &contextHTMLRender{HTMLRender: e.HTMLRender, funcs: e.contextFuncs}
+	if production, ok := e.HTMLRender.(render.HTMLProduction); ok {
+		r.pristine = template.Must(production.Template.Clone())
+	}
+	e.HTMLRender = r
+}
+
+// Pre registers middleware running before gin routing, e.g. to rewrite the path or the method of the request.
+// Call it before registering routes. When the middleware changes the method or the path the request is
+// routed again, values set with c.Set are reset by the new routing. The middleware must not call c.Next,
+// it ends the request with c.Abort.
+func (e *Engine) Pre(middleware ...gin.HandlerFunc) {
+	if len(e.pre) == 0 {
+		e.Engine.Handlers = append(gin.HandlersChain{e.preRouting}, e.Engine.Handlers...)
+		// rebuild the 404 and 405 handlers
+		e.Engine.Use()
+	}
+	e.pre = append(e.pre, middleware...)
+}
+
+func (e *Engine) preRouting(c *gin.Context) {
+	if c.Request.Context().Value(preRoutedKey{}) != nil {
+		return
+	}
+	method, path := c.Request.Method, c.Request.URL.Path
+	for _, handler := range e.pre {
+		handler(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+	if c.Request.Method == method && c.Request.URL.Path == path {
+		return
+	}
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), preRoutedKey{}, true))
+	e.HandleContext(c)
+	c.Abort()
+}
+
+// PrefixController registers the routes of controllers under prefix, every controller gets its own group
+// so IMiddleware applies to its routes only.
 func (e *Engine) PrefixController(prefix string, controllers ...IController) {
 	eg := e.Engine.Group(prefix)
-	var route gin.IRoutes
 	for _, gc := range controllers {
-		if eg == nil || gc == nil {
+		if gc == nil {
 			continue
 		}
-		route = eg
+		var middleware []gin.HandlerFunc
+		if m, ok := gc.(IMiddleware); ok {
+			middleware = m.Middleware()
+		}
+		relativePath := ""
 		if len(gc.Prefix()) > 1 {
-			route = eg.Group(gc.Prefix())
+			relativePath = gc.Prefix()
 		}
-		gc.Routes(route)
+		gc.Routes(eg.Group(relativePath, middleware...))
 	}
 }
 func (e *Engine) Controller(controllers ...IController) {
 	e.PrefixController("", controllers...)
 }
-func (e *Engine) Plugin(Plugins ...IPlugin) {
-	group := e.Group("")
-	for i := range Plugins {
-		PluginGroup := group.Group(Plugins[i].RouterPath())
-		Plugins[i].Register(PluginGroup)
-	}
-}
@@ -0,0 +1,95 @@
+package igin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func trace(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("trace", append(c.GetStringSlice("trace"), name))
+	}
+}
+
+func traced(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.String(http.StatusOK, strings.Join(append(c.GetStringSlice("trace"), name), ","))
+	}
+}
+
+type adminController struct{}
+
+func (adminController) Prefix() string { return "/admin" }
+func (adminController) Routes(g gin.IRoutes) {
+	g.GET("/stats", trace("route"), traced("handler"))
+}
+func (adminController) Middleware() []gin.HandlerFunc {
+	return []gin.HandlerFunc{trace("controller1"), trace("controller2")}
+}
+
+type guardedController struct{}
+
+func (guardedController) Prefix() string { return "" }
+func (guardedController) Routes(g gin.IRoutes) {
+	g.GET("/guarded", traced("handler"))
+}
+func (guardedController) Middleware() []gin.HandlerFunc {
+	return []gin.HandlerFunc{func(c *gin.Context) {
+		c.AbortWithStatus(http.StatusForbidden)
+	}}
+}
+
+type publicController struct{}
+
+func (publicController) Prefix() string { return "" }
+func (publicController) Routes(g gin.IRoutes) {
+	g.GET("/public", traced("handler"))
+}
+
+type tracedPlugin struct{}
+
+func (tracedPlugin) RouterPath() string { return "/plugin" }
+func (tracedPlugin) Register(group *gin.RouterGroup) {
+	group.Use(trace("register"))
+	group.GET("", traced("handler"))
+}
+func (tracedPlugin) Middleware() []gin.HandlerFunc {
+	return []gin.HandlerFunc{trace("plugin")}
+}
+
+type tracedResource struct{}
+
+func (tracedResource) Show(c *gin.Context) { traced("handler")(c) }
+func (tracedResource) Middleware() []gin.HandlerFunc {
+	return []gin.HandlerFunc{trace("controller")}
+}
+func (tracedResource) ActionMiddleware(action string) []gin.HandlerFunc {
+	return []gin.HandlerFunc{trace(action)}
+}
+
+func TestEngineMiddlewareOrder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := New()
+	e.Use(trace("engine"))
+	e.PrefixController("/api", guardedController{}, adminController{}, publicController{})
+	e.Plugin(tracedPlugin{})
+	e.Resource("/items", tracedResource{})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	assert.Equal(t, "engine,controller1,controller2,route,handler", get("/api/admin/stats").Body.String(),
+		"engine middleware, controller middleware in order, route middleware, handler")
+	assert.Equal(t, http.StatusForbidden, get("/api/guarded").Code)
+	assert.Equal(t, "engine,handler", get("/api/public").Body.String(), "controller middleware does not leak to siblings")
+	assert.Equal(t, "engine,plugin,register,handler", get("/plugin").Body.String())
+	assert.Equal(t, "engine,controller,show,handler", get("/items/1").Body.String())
+}
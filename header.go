@@ -38,6 +38,17 @@ const (
 	HeaderConnection          = "Connection"
 	HeaderUserAgent           = "User-Agent"
 
+	// HeaderXForwardedClientCert carries the client certificate when TLS is terminated by a proxy.
+	HeaderXForwardedClientCert = "X-Forwarded-Client-Cert"
+	HeaderReferer              = "Referer"
+	HeaderETag                 = "ETag"
+	HeaderIfNoneMatch          = "If-None-Match"
+	HeaderAge                  = "Age"
+	HeaderXCache               = "X-Cache"
+	HeaderXForwardedHost       = "X-Forwarded-Host"
+	HeaderLastEventID          = "Last-Event-ID"
+	HeaderXAccelBuffering      = "X-Accel-Buffering"
+
 	// Access control
 	HeaderAccessControlRequestMethod    = "Access-Control-Request-Method"
 	HeaderAccessControlRequestHeaders   = "Access-Control-Request-Headers"
@@ -48,6 +59,16 @@ const (
 	HeaderAccessControlExposeHeaders    = "Access-Control-Expose-Headers"
 	HeaderAccessControlMaxAge           = "Access-Control-Max-Age"
 
+	// Private Network Access
+	HeaderAccessControlRequestPrivateNetwork = "Access-Control-Request-Private-Network"
+	HeaderAccessControlAllowPrivateNetwork   = "Access-Control-Allow-Private-Network"
+
+	// WebSocket
+	HeaderSecWebSocketKey      = "Sec-WebSocket-Key"
+	HeaderSecWebSocketAccept   = "Sec-WebSocket-Accept"
+	HeaderSecWebSocketVersion  = "Sec-WebSocket-Version"
+	HeaderSecWebSocketProtocol = "Sec-WebSocket-Protocol"
+
 	// Security
 	HeaderStrictTransportSecurity         = "Strict-Transport-Security"
 	HeaderXContentTypeOptions             = "X-Content-Type-Options"
@@ -57,6 +78,22 @@ const (
 	HeaderContentSecurityPolicyReportOnly = "Content-Security-Policy-Report-Only"
 	HeaderXCSRFToken                      = "X-CSRF-Token"
 	HeaderReferrerPolicy                  = "Referrer-Policy"
+	HeaderReportingEndpoints              = "Reporting-Endpoints"
+	HeaderPermissionsPolicy               = "Permissions-Policy"
+	HeaderCrossOriginOpenerPolicy         = "Cross-Origin-Opener-Policy"
+	HeaderCrossOriginEmbedderPolicy       = "Cross-Origin-Embedder-Policy"
+	HeaderCrossOriginResourcePolicy       = "Cross-Origin-Resource-Policy"
+	HeaderXPermittedCrossDomainPolicies   = "X-Permitted-Cross-Domain-Policies"
+
+	// Signature
+	HeaderXSignature          = "X-Signature"
+	HeaderXSignatureTimestamp = "X-Signature-Timestamp"
+	HeaderXHubSignature256    = "X-Hub-Signature-256"
+	HeaderStripeSignature     = "Stripe-Signature"
+
+	// Idempotency
+	HeaderIdempotencyKey     = "Idempotency-Key"
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
 
 	charsetUTF8 = "charset=UTF-8"
 	// PROPFIND Method can be used on collection and property resources.
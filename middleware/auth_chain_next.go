@@ -0,0 +1,198 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/pkg6/igin/xerror"
+)
+
+const (
+	AuthSchemeKey   = "key"
+	AuthSchemeBasic = "basic"
+)
+
+type (
+	// AuthChainConfig defines the config for AuthChain middleware.
+	AuthChainConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+		// Authenticators are tried in order, the first one to succeed wins.
+		// Required.
+		Authenticators []Authenticator
+		// SuccessHandler defines a function which is executed after an authenticator succeeded before middleware
+		// chain continues with next middleware or handler.
+		SuccessHandler SuccessHandler
+		// ErrorHandler defines a function which is executed when all authenticators failed.
+		ErrorHandler ErrorHandler
+		// Context key to store the *Principal into context.
+		// Optional. Default value "principal".
+		ContextKey string
+	}
+
+	// Authenticator authenticates a request without aborting it, so several of them can be chained.
+	Authenticator struct {
+		// Scheme names the authenticator and is recorded in the Principal.
+		Scheme string
+		// Authenticate returns the authenticated principal. It returns an *ErrAuthMissing when the request carries
+		// no credentials for this authenticator, any other error means the credentials were rejected.
+		Authenticate func(c *gin.Context) (any, error)
+	}
+
+	// Principal is the uniform result of a successful AuthChain authentication.
+	Principal struct {
+		// Scheme of the authenticator that succeeded.
+		Scheme string
+		// Value returned by the authenticator, e.g. *jwt.Token, *APIKey or the basic auth username.
+		Value any
+	}
+)
+
+var (
+	PrincipalContextKey = "principal"
+	// DefaultAuthChainConfig is the default AuthChain middleware config.
+	defaultAuthChainConfig = AuthChainConfig{
+		Skipper:      DefaultSkipper,
+		ErrorHandler: DefaultErrorHandler,
+		ContextKey:   PrincipalContextKey,
+	}
+	ErrAuthChainMissing = xerror.NewHTTPError(http.StatusUnauthorized, "missing credentials")
+	ErrBasicAuthInvalid = xerror.NewHTTPError(http.StatusUnauthorized, "invalid basic auth credentials")
+)
+
+// AuthChainNext returns an AuthChain middleware trying authenticators in order.
+func AuthChainNext(authenticators ...Authenticator) gin.HandlerFunc {
+	c := defaultAuthChainConfig
+	c.Authenticators = authenticators
+	return AuthChainNextWithConfig(c)
+}
+
+// AuthChainNextWithConfig returns an AuthChain middleware with config.
+//
+// The principal of the first authenticator to succeed is stored into context.
+// When all of them fail the ErrorHandler is called once, errors of rejected credentials are prioritized over
+// missing credentials and the first rejection in order is reported.
+func AuthChainNextWithConfig(config AuthChainConfig) gin.HandlerFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = defaultAuthChainConfig.Skipper
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = defaultAuthChainConfig.ErrorHandler
+	}
+	if config.ContextKey == "" {
+		config.ContextKey = defaultAuthChainConfig.ContextKey
+	}
+	if len(config.Authenticators) == 0 {
+		panic("IGin: auth-chain middleware requires authenticators")
+	}
+	return func(c *gin.Context) {
+		if config.Skipper(c) {
+			c.Next()
+			return
+		}
+		var rejectedErr error
+		for _, authenticator := range config.Authenticators {
+			value, err := authenticator.Authenticate(c)
+			if err == nil {
+				c.Set(config.ContextKey, &Principal{Scheme: authenticator.Scheme, Value: value})
+				if config.SuccessHandler != nil {
+					config.SuccessHandler(c)
+				}
+				c.Next()
+				return
+			}
+			var missing *ErrAuthMissing
+			if rejectedErr == nil && !errors.As(err, &missing) {
+				rejectedErr = err
+			}
+		}
+		if rejectedErr == nil {
+			config.ErrorHandler(c, ErrAuthChainMissing, ErrAuthChainMissing.Code)
+			return
+		}
+		var he *xerror.HTTPError
+		if errors.As(rejectedErr, &he) {
+			config.ErrorHandler(c, rejectedErr, he.Code)
+			return
+		}
+		config.ErrorHandler(c, rejectedErr, http.StatusUnauthorized)
+	}
+}
+
+// ContextPrincipal returns the principal stored by the AuthChain middleware,
+// pass contextKey when the middleware is configured with a custom ContextKey.
+func ContextPrincipal(c *gin.Context, contextKey ...string) (*Principal, error) {
+	key := PrincipalContextKey
+	if len(contextKey) > 0 && contextKey[0] != "" {
+		key = contextKey[0]
+	}
+	if value, exists := c.Get(key); exists {
+		if principal, ok := value.(*Principal); ok {
+			return principal, nil
+		}
+	}
+	return nil, errors.New("principal information does not exist")
+}
+
+// KeyAuthAuthenticator returns an Authenticator for KeyAuth config.
+// The principal is the *APIKey when KeyStoreValidator is used, the raw key otherwise.
+func KeyAuthAuthenticator(config KeyAuthConfig) Authenticator {
+	config, extractors := keyAuthConfigDefaults(config)
+	return Authenticator{
+		Scheme: AuthSchemeKey,
+		Authenticate: func(c *gin.Context) (any, error) {
+			key, err := keyAuthenticate(c, config, extractors)
+			if err != nil {
+				var missing *ErrKeyAuthMissing
+				if errors.As(err, &missing) {
+					return nil, &ErrAuthMissing{Err: err}
+				}
+				return nil, err
+			}
+			if apiKey, err := ContextAPIKey(c); err == nil {
+				return apiKey, nil
+			}
+			return key, nil
+		},
+	}
+}
+
+// BasicAuthAuthenticator returns an Authenticator for BasicAuth credentials, the principal is the username.
+func BasicAuthAuthenticator(fn BasicAuthValidator) Authenticator {
+	if fn == nil {
+		panic("GIN: basic-auth authenticator requires a validator function")
+	}
+	return Authenticator{
+		Scheme: AuthSchemeBasic,
+		Authenticate: func(c *gin.Context) (any, error) {
+			auth := c.Request.Header.Get(igin.HeaderAuthorization)
+			if len(auth) <= len(basic) || !strings.EqualFold(auth[:len(basic)], basic) {
+				return nil, &ErrAuthMissing{Err: errors.New("missing basic auth credentials")}
+			}
+			s1, s2, err := basicAuthNextSearchCredential(auth)
+			if err != nil || !fn(s1, s2, c) {
+				return nil, ErrBasicAuthInvalid
+			}
+			return s1, nil
+		},
+	}
+}
+
+// ErrAuthMissing is returned by an Authenticator when the request carries no credentials for it.
+type ErrAuthMissing struct {
+	Err error
+}
+
+// Error returns errors text
+func (e *ErrAuthMissing) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap unwraps error
+func (e *ErrAuthMissing) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,67 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	gojwt "github.com/golang-jwt/jwt"
+	"github.com/pkg6/igin/middleware"
+	"github.com/pkg6/igin/middleware/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthChainNext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	raw, key, _ := middleware.NewAPIKey("service")
+	signed, _ := gojwt.NewWithClaims(gojwt.SigningMethodHS256, gojwt.MapClaims{"sub": "igin"}).SignedString([]byte("secret"))
+	g := gin.New()
+	g.Use(middleware.AuthChainNextWithConfig(middleware.AuthChainConfig{
+		ContextKey: "auth",
+		Authenticators: []middleware.Authenticator{
+			jwt.Authenticator(jwt.JWTConfig{SigningKey: "secret"}),
+			middleware.KeyAuthAuthenticator(middleware.KeyAuthConfig{
+				KeyLookup: "header:X-Api-Key",
+				Validator: middleware.KeyStoreValidator(middleware.NewMemoryKeyStore(key)),
+			}),
+			middleware.BasicAuthAuthenticator(func(user, password string, c *gin.Context) bool {
+				return user == "admin" && password == "secret"
+			}),
+		},
+	}))
+	g.GET("/", func(c *gin.Context) {
+		principal, err := middleware.ContextPrincipal(c, "auth")
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.String(http.StatusOK, principal.Scheme)
+	})
+	cases := []struct {
+		header string
+		value  string
+		status int
+		body   string
+	}{
+		{header: "Authorization", value: "Bearer " + signed, status: http.StatusOK, body: jwt.AuthScheme},
+		{header: "Authorization", value: "Bearer invalid", status: http.StatusUnauthorized},
+		{header: "X-Api-Key", value: raw, status: http.StatusOK, body: middleware.AuthSchemeKey},
+		{header: "Authorization", value: "Basic YWRtaW46c2VjcmV0", status: http.StatusOK, body: middleware.AuthSchemeBasic},
+		{header: "Authorization", value: "Basic YWRtaW46d3Jvbmc=", status: http.StatusUnauthorized},
+		{header: "X-Api-Key", value: "unknown.key", status: http.StatusUnauthorized},
+		{status: http.StatusUnauthorized},
+	}
+	for _, each := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if each.header != "" {
+			req.Header.Set(each.header, each.value)
+		}
+		g.ServeHTTP(w, req)
+		assert.Equal(t, each.status, w.Code, each)
+		if each.body != "" {
+			assert.Equal(t, each.body, w.Body.String())
+		}
+	}
+}
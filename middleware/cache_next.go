@@ -0,0 +1,496 @@
+package middleware
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+)
+
+type (
+	// CacheConfig defines the config for Cache middleware.
+	CacheConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+		// Store keeps the cached responses, share it to purge entries.
+		// Optional. Default value NewCacheStore(1000).
+		Store *CacheStore
+		// TTL is how long responses are served from cache.
+		// Optional. Default value 1 minute.
+		TTL time.Duration
+		// KeyHeaders are request headers the responses vary by, e.g. "Accept-Language".
+		// Optional.
+		KeyHeaders []string
+		// KeyFunc returns the cache key, it overrides the default "<method> <path>?<sorted query>" key.
+		// Optional.
+		KeyFunc func(c *gin.Context) string
+		// WeakETag generates weak ETags (W/"...") instead of strong ones.
+		// Optional. Default value false.
+		WeakETag bool
+		// MaxBodySize is the largest response body cached, larger responses are streamed.
+		// Optional. Default value 1MB.
+		MaxBodySize int
+		// CredentialCookies are the names of cookies carrying credentials, e.g. the session cookie.
+		// Requests with them are treated like requests with an Authorization header.
+		// Optional.
+		CredentialCookies []string
+		// AllowAuthenticated caches responses to authenticated requests like any other response.
+		// Only enable it when KeyFunc or KeyHeaders separate the users.
+		// Optional. Default value false, only "public" or "s-maxage" responses are shared with authenticated requests.
+		AllowAuthenticated bool
+	}
+
+	// CacheEntry is a cached response.
+	CacheEntry struct {
+		Status       int
+		Header       http.Header
+		Body         []byte
+		ETag         string
+		LastModified time.Time
+		Created      time.Time
+		Expires      time.Time
+		// Public reports whether the response may be served to authenticated requests.
+		Public bool
+		// Vary lists the request headers of the Vary response header, the entry is also stored under a key
+		// including their values and only served to requests with the same values.
+		Vary []string
+	}
+
+	// CacheStore is an in-memory LRU cache of responses.
+	CacheStore struct {
+		mu       sync.Mutex
+		capacity int
+		ll       *list.List
+		items    map[string]*list.Element
+	}
+
+	cacheItem struct {
+		key   string
+		entry *CacheEntry
+	}
+
+	cacheWriter struct {
+		gin.ResponseWriter
+		body  bytes.Buffer
+		limit int
+		// streaming responses are written through and not cached
+		streaming bool
+	}
+
+	cacheControl struct {
+		noCache      bool
+		noStore      bool
+		onlyIfCached bool
+		maxAge       int
+	}
+)
+
+var (
+	// DefaultCacheConfig is the default Cache middleware config.
+	defaultCacheConfig = CacheConfig{
+		Skipper:     DefaultSkipper,
+		TTL:         time.Minute,
+		MaxBodySize: 1 << 20,
+	}
+)
+
+// CacheNext returns a Cache middleware caching responses for ttl.
+func CacheNext(ttl time.Duration) gin.HandlerFunc {
+	c := defaultCacheConfig
+	c.TTL = ttl
+	return CacheNextWithConfig(c)
+}
+
+// CacheNextWithConfig returns a Cache middleware with config.
+//
+// Successful GET responses are cached unless they set cookies, "Cache-Control: no-store" or "private" or
+// "Vary: *", HEAD requests are served from the GET entries. Entries are only served to requests with the same
+// values of the request headers listed in Vary. Flushed, too large and text/event-stream responses are streamed.
+// Like a shared cache, responses to requests with Authorization or CredentialCookies are only cached and served
+// when they are "public" or have "s-maxage", see AllowAuthenticated.
+// The request directives no-cache, no-store, max-age and only-if-cached are honored. Responses get an ETag and
+// Last-Modified, conditional requests with matching If-None-Match or If-Modified-Since are answered with 304.
+func CacheNextWithConfig(config CacheConfig) gin.HandlerFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = defaultCacheConfig.Skipper
+	}
+	if config.Store == nil {
+		config.Store = NewCacheStore(1000)
+	}
+	if config.TTL == 0 {
+		config.TTL = defaultCacheConfig.TTL
+	}
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = defaultCacheConfig.MaxBodySize
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = func(c *gin.Context) string {
+			return CacheKey(c, config.KeyHeaders...)
+		}
+	}
+	return func(c *gin.Context) {
+		if config.Skipper(c) || (c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead) {
+			c.Next()
+			return
+		}
+		cc := parseCacheControl(c.Request.Header.Get(igin.HeaderCacheControl))
+		key := config.KeyFunc(c)
+		shared := config.AllowAuthenticated || !authenticatedRequest(c.Request, config.CredentialCookies)
+		if !cc.noCache && !cc.noStore {
+			entry, ok := config.Store.Get(key)
+			if ok && len(entry.Vary) > 0 {
+				entry, ok = config.Store.Get(cacheVaryKey(key, entry.Vary, c.Request))
+			}
+			if ok && (shared || entry.Public) {
+				age := time.Since(entry.Created)
+				if cc.maxAge < 0 || age <= time.Duration(cc.maxAge)*time.Second {
+					header := c.Writer.Header()
+					for name, values := range entry.Header {
+						header[name] = values
+					}
+					header.Set(igin.HeaderXCache, "HIT")
+					header.Set(igin.HeaderAge, strconv.Itoa(int(age.Seconds())))
+					writeCacheResponse(c, entry.Status, entry.Body, entry.ETag, entry.LastModified)
+					c.Abort()
+					return
+				}
+			}
+		}
+		if cc.onlyIfCached {
+			c.AbortWithStatus(http.StatusGatewayTimeout)
+			return
+		}
+		writer := &cacheWriter{ResponseWriter: c.Writer, limit: config.MaxBodySize}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+		if writer.streaming {
+			return
+		}
+		header := c.Writer.Header()
+		status := writer.Status()
+		body := writer.body.Bytes()
+		if status != http.StatusOK {
+			c.Writer.WriteHeader(status)
+			_, _ = c.Writer.Write(body)
+			return
+		}
+		etag := header.Get(igin.HeaderETag)
+		if etag == "" {
+			etag = cacheETag(body, config.WeakETag)
+			header.Set(igin.HeaderETag, etag)
+		}
+		now := time.Now()
+		lastModified, err := http.ParseTime(header.Get(igin.HeaderLastModified))
+		if err != nil {
+			lastModified = now.UTC().Truncate(time.Second)
+			header.Set(igin.HeaderLastModified, lastModified.Format(http.TimeFormat))
+		}
+		public := publicResponse(header)
+		if c.Request.Method == http.MethodGet && !cc.noStore && cacheableResponse(header) && (shared || public) {
+			entry := &CacheEntry{
+				Status:       status,
+				Header:       header.Clone(),
+				Body:         append([]byte(nil), body...),
+				ETag:         etag,
+				LastModified: lastModified,
+				Created:      now,
+				Expires:      now.Add(config.TTL),
+				Public:       public,
+				Vary:         responseVary(header),
+			}
+			config.Store.Set(key, entry)
+			if len(entry.Vary) > 0 {
+				config.Store.Set(cacheVaryKey(key, entry.Vary, c.Request), entry)
+			}
+		}
+		header.Set(igin.HeaderXCache, "MISS")
+		writeCacheResponse(c, status, body, etag, lastModified)
+	}
+}
+
+// CacheKey returns the default cache key "<method> <path>?<sorted query>" followed by the values of headers.
+// HEAD requests share the key of GET.
+func CacheKey(c *gin.Context, headers ...string) string {
+	method := c.Request.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	var b strings.Builder
+	b.WriteString(method)
+	b.WriteByte(' ')
+	b.WriteString(c.Request.URL.Path)
+	if query := c.Request.URL.Query(); len(query) > 0 {
+		b.WriteByte('?')
+		b.WriteString(query.Encode())
+	}
+	for _, name := range headers {
+		b.WriteByte('|')
+		b.WriteString(c.Request.Header.Get(name))
+	}
+	return b.String()
+}
+
+// cacheVaryKey returns key followed by the values of the vary request headers.
+func cacheVaryKey(key string, vary []string, r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(key)
+	b.WriteString(cacheVarySeparator)
+	for _, name := range vary {
+		b.WriteByte('|')
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+const cacheVarySeparator = "|vary"
+
+// responseVary returns the sorted canonical request header names of the Vary header.
+func responseVary(header http.Header) []string {
+	var vary []string
+	for _, value := range header.Values(igin.HeaderVary) {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				vary = append(vary, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(vary)
+	return vary
+}
+
+// writeCacheResponse answers conditional requests with 304, otherwise it writes the response.
+func writeCacheResponse(c *gin.Context, status int, body []byte, etag string, lastModified time.Time) {
+	if cacheNotModified(c.Request, etag, lastModified) {
+		c.Writer.Header().Del(igin.HeaderContentLength)
+		c.Writer.Header().Del(igin.HeaderContentType)
+		c.Writer.WriteHeader(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	c.Writer.WriteHeader(status)
+	_, _ = c.Writer.Write(body)
+}
+
+func cacheNotModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get(igin.HeaderIfNoneMatch); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if ims, err := http.ParseTime(r.Header.Get(igin.HeaderIfModifiedSince)); err == nil {
+		return !lastModified.Truncate(time.Second).After(ims)
+	}
+	return false
+}
+
+func cacheableResponse(header http.Header) bool {
+	if header.Get("Set-Cookie") != "" {
+		return false
+	}
+	for _, name := range responseVary(header) {
+		if name == "*" {
+			return false
+		}
+	}
+	cc := strings.ToLower(header.Get(igin.HeaderCacheControl))
+	return !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private")
+}
+
+// publicResponse reports whether a shared cache may serve the response to authenticated requests (RFC 9111 3.5).
+func publicResponse(header http.Header) bool {
+	for _, directive := range strings.Split(strings.ToLower(header.Get(igin.HeaderCacheControl)), ",") {
+		name, _, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if name == "public" || name == "s-maxage" {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticatedRequest reports whether r carries an Authorization header or one of the credential cookies.
+func authenticatedRequest(r *http.Request, credentialCookies []string) bool {
+	if r.Header.Get(igin.HeaderAuthorization) != "" {
+		return true
+	}
+	for _, name := range credentialCookies {
+		if _, err := r.Cookie(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func cacheETag(body []byte, weak bool) string {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if weak {
+		return "W/" + etag
+	}
+	return etag
+}
+
+func parseCacheControl(value string) cacheControl {
+	cc := cacheControl{maxAge: -1}
+	for _, directive := range strings.Split(value, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache":
+			cc.noCache = true
+		case "no-store":
+			cc.noStore = true
+		case "only-if-cached":
+			cc.onlyIfCached = true
+		case "max-age":
+			if seconds, err := strconv.Atoi(strings.Trim(arg, `"`)); err == nil && seconds >= 0 {
+				cc.maxAge = seconds
+			}
+		}
+	}
+	return cc
+}
+
+func (w *cacheWriter) Write(b []byte) (int, error) {
+	if !w.streaming && (w.body.Len()+len(b) > w.limit || eventStream(w.Header())) {
+		// too large to cache or an event stream, stream what was buffered and the rest
+		if err := w.stream(); err != nil {
+			return 0, err
+		}
+	}
+	if w.streaming {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+func (w *cacheWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush streams the response, flushed responses are not cached.
+func (w *cacheWriter) Flush() {
+	_ = w.stream()
+	w.ResponseWriter.Flush()
+}
+
+// WriteHeaderNow streams the response, the header can not be changed afterwards.
+func (w *cacheWriter) WriteHeaderNow() {
+	_ = w.stream()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// stream switches to writing through, the buffered body is written first.
+func (w *cacheWriter) stream() error {
+	if w.streaming {
+		return nil
+	}
+	w.streaming = true
+	if w.body.Len() == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.body.Bytes())
+	w.body.Reset()
+	return err
+}
+
+func eventStream(header http.Header) bool {
+	return strings.HasPrefix(header.Get(igin.HeaderContentType), igin.MIMEEventStream)
+}
+
+// Unwrap returns the wrapped ResponseWriter.
+func (w *cacheWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// NewCacheStore returns a CacheStore keeping at most capacity entries.
+func NewCacheStore(capacity int) *CacheStore {
+	if capacity <= 0 {
+		panic("IGin: cache store requires a positive capacity")
+	}
+	return &CacheStore{capacity: capacity, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Get returns the entry of key unless it expired.
+func (s *CacheStore) Get(key string) (*CacheEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	element, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := element.Value.(*cacheItem)
+	if time.Now().After(item.entry.Expires) {
+		s.ll.Remove(element)
+		delete(s.items, key)
+		return nil, false
+	}
+	s.ll.MoveToFront(element)
+	return item.entry, true
+}
+
+// Set stores entry under key, evicting the least recently used entry when full.
+func (s *CacheStore) Set(key string, entry *CacheEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.items[key]; ok {
+		element.Value.(*cacheItem).entry = entry
+		s.ll.MoveToFront(element)
+		return
+	}
+	s.items[key] = s.ll.PushFront(&cacheItem{key: key, entry: entry})
+	if s.ll.Len() > s.capacity {
+		oldest := s.ll.Back()
+		s.ll.Remove(oldest)
+		delete(s.items, oldest.Value.(*cacheItem).key)
+	}
+}
+
+// Delete removes the entry of key and its Vary entries.
+func (s *CacheStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, element := range s.items {
+		if k == key || strings.HasPrefix(k, key+cacheVarySeparator) {
+			s.ll.Remove(element)
+			delete(s.items, k)
+		}
+	}
+}
+
+// Purge removes the entries whose key starts with prefix, e.g. "GET /users", and returns their number.
+func (s *CacheStore) Purge(prefix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for key, element := range s.items {
+		if strings.HasPrefix(key, prefix) {
+			s.ll.Remove(element)
+			delete(s.items, key)
+			n++
+		}
+	}
+	return n
+}
+
+// Len returns the number of entries, including expired ones not evicted yet.
+func (s *CacheStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ll.Len()
+}
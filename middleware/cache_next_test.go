@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheNextWithConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := NewCacheStore(2)
+	calls := 0
+	g := gin.New()
+	g.Use(CacheNextWithConfig(CacheConfig{Store: store, TTL: time.Minute}))
+	g.GET("/users/:id", func(c *gin.Context) {
+		calls++
+		c.String(http.StatusOK, "user %s %d", c.Param("id"), calls)
+	})
+	g.GET("/private", func(c *gin.Context) {
+		calls++
+		c.Header(igin.HeaderCacheControl, "private")
+		c.String(http.StatusOK, strconv.Itoa(calls))
+	})
+
+	get := func(path string, headers ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		g.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/users/1?b=2&a=1")
+	assert.Equal(t, "user 1 1", w.Body.String())
+	assert.Equal(t, "MISS", w.Header().Get(igin.HeaderXCache))
+	etag := w.Header().Get(igin.HeaderETag)
+	assert.NotEmpty(t, etag)
+	assert.NotEmpty(t, w.Header().Get(igin.HeaderLastModified))
+
+	w = get("/users/1?a=1&b=2")
+	assert.Equal(t, "user 1 1", w.Body.String(), "query order does not matter")
+	assert.Equal(t, "HIT", w.Header().Get(igin.HeaderXCache))
+
+	w = get("/users/1?a=1&b=2", igin.HeaderIfNoneMatch, etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = get("/users/1?a=1&b=2", igin.HeaderIfModifiedSince, time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	w = get("/users/1?a=1&b=2", igin.HeaderCacheControl, "no-cache")
+	assert.Equal(t, "user 1 2", w.Body.String())
+
+	assert.Equal(t, http.StatusGatewayTimeout, get("/users/2", igin.HeaderCacheControl, "only-if-cached").Code)
+
+	get("/private")
+	assert.Equal(t, "4", get("/private").Body.String(), "private responses are not cached")
+
+	get("/users/2")
+	get("/users/3")
+	assert.Equal(t, 2, store.Len(), "least recently used entries are evicted")
+	assert.Equal(t, 2, store.Purge("GET /users/"))
+	assert.Equal(t, "MISS", get("/users/3").Header().Get(igin.HeaderXCache))
+}
+
+func TestCacheNextAuthenticated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := func(config CacheConfig) *gin.Engine {
+		g := gin.New()
+		g.Use(CacheNextWithConfig(config))
+		g.GET("/me", func(c *gin.Context) {
+			session, _ := c.Cookie("session")
+			c.String(http.StatusOK, c.GetHeader(igin.HeaderAuthorization)+session)
+		})
+		g.GET("/public", func(c *gin.Context) {
+			c.Header(igin.HeaderCacheControl, "public, max-age=60")
+			c.String(http.StatusOK, c.GetHeader(igin.HeaderAuthorization))
+		})
+		g.HEAD("/head", func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		g.GET("/head", func(c *gin.Context) {
+			c.String(http.StatusOK, "body")
+		})
+		return g
+	}
+	serve := func(g *gin.Engine, method, path string, headers ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		g.ServeHTTP(w, req)
+		return w
+	}
+
+	g := engine(CacheConfig{CredentialCookies: []string{"session"}})
+	assert.Equal(t, "Bearer a", serve(g, http.MethodGet, "/me", igin.HeaderAuthorization, "Bearer a").Body.String())
+	w := serve(g, http.MethodGet, "/me", igin.HeaderAuthorization, "Bearer b")
+	assert.Equal(t, "Bearer b", w.Body.String(), "authenticated responses are not shared")
+	assert.Equal(t, "MISS", w.Header().Get(igin.HeaderXCache))
+	serve(g, http.MethodGet, "/me", "Cookie", "session=a")
+	assert.Equal(t, "b", serve(g, http.MethodGet, "/me", "Cookie", "session=b").Body.String(), "credential cookies count as authentication")
+
+	serve(g, http.MethodGet, "/me")
+	assert.Equal(t, "Bearer a", serve(g, http.MethodGet, "/me", igin.HeaderAuthorization, "Bearer a").Body.String(),
+		"anonymous entries are not served to authenticated requests")
+
+	serve(g, http.MethodGet, "/public", igin.HeaderAuthorization, "Bearer a")
+	w = serve(g, http.MethodGet, "/public", igin.HeaderAuthorization, "Bearer b")
+	assert.Equal(t, "HIT", w.Header().Get(igin.HeaderXCache), "public responses are shared")
+
+	g = engine(CacheConfig{AllowAuthenticated: true, KeyHeaders: []string{igin.HeaderAuthorization}})
+	serve(g, http.MethodGet, "/me", igin.HeaderAuthorization, "Bearer a")
+	w = serve(g, http.MethodGet, "/me", igin.HeaderAuthorization, "Bearer a")
+	assert.Equal(t, "HIT", w.Header().Get(igin.HeaderXCache))
+	assert.Equal(t, "Bearer b", serve(g, http.MethodGet, "/me", igin.HeaderAuthorization, "Bearer b").Body.String())
+
+	assert.Equal(t, http.StatusOK, serve(g, http.MethodHead, "/head").Code)
+	w = serve(g, http.MethodGet, "/head")
+	assert.Equal(t, "MISS", w.Header().Get(igin.HeaderXCache), "HEAD responses are not stored")
+	assert.Equal(t, "body", w.Body.String())
+	assert.Equal(t, "HIT", serve(g, http.MethodHead, "/head").Header().Get(igin.HeaderXCache), "HEAD is served from GET")
+}
+
+func TestCacheNextVary(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	calls := 0
+	g := gin.New()
+	g.Use(CORSNextWithConfig(CORSConfig{AllowOrigins: []string{"https://a.com", "https://b.com"}}))
+	g.Use(CacheNextWithConfig(CacheConfig{}))
+	g.GET("/feed", func(c *gin.Context) {
+		calls++
+		c.String(http.StatusOK, strconv.Itoa(calls))
+	})
+	g.GET("/any", func(c *gin.Context) {
+		calls++
+		c.Header(igin.HeaderVary, "*")
+		c.String(http.StatusOK, strconv.Itoa(calls))
+	})
+	get := func(path, origin string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(igin.HeaderOrigin, origin)
+		g.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, "https://a.com", get("/feed", "https://a.com").Header().Get(igin.HeaderAccessControlAllowOrigin))
+	w := get("/feed", "https://b.com")
+	assert.Equal(t, "MISS", w.Header().Get(igin.HeaderXCache), "responses vary by origin")
+	assert.Equal(t, "https://b.com", w.Header().Get(igin.HeaderAccessControlAllowOrigin))
+	w = get("/feed", "https://a.com")
+	assert.Equal(t, "HIT", w.Header().Get(igin.HeaderXCache))
+	assert.Equal(t, "https://a.com", w.Header().Get(igin.HeaderAccessControlAllowOrigin))
+	assert.Equal(t, "1", w.Body.String())
+
+	get("/any", "https://a.com")
+	assert.Equal(t, "4", get("/any", "https://a.com").Body.String(), "Vary: * responses are not cached")
+}
+
+func TestCacheNextStreaming(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	calls := 0
+	g := gin.New()
+	g.Use(CacheNextWithConfig(CacheConfig{}))
+	g.GET("/flush", func(c *gin.Context) {
+		calls++
+		c.String(http.StatusOK, "a")
+		c.Writer.Flush()
+		c.String(http.StatusOK, "b")
+	})
+	g.GET("/events", func(c *gin.Context) {
+		calls++
+		c.SSEvent("message", strconv.Itoa(calls))
+	})
+	g.GET("/created", func(c *gin.Context) {
+		calls++
+		c.Writer.WriteHeader(http.StatusCreated)
+		c.Writer.WriteHeaderNow()
+		c.String(http.StatusCreated, "created")
+	})
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("/flush")
+	assert.Equal(t, "ab", w.Body.String())
+	assert.True(t, w.Flushed)
+	assert.Empty(t, w.Header().Get(igin.HeaderXCache))
+	assert.Equal(t, "ab", get("/flush").Body.String())
+	assert.Equal(t, 2, calls, "flushed responses are not cached")
+
+	w = get("/events")
+	assert.Contains(t, w.Body.String(), "data:3")
+	assert.Contains(t, get("/events").Body.String(), "data:4", "event streams are not cached")
+
+	w = get("/created")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "created", w.Body.String())
+}
@@ -0,0 +1,294 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin/xT"
+	"github.com/pkg6/igin/xerror"
+)
+
+type (
+	// ClientCertConfig defines the config for ClientCert middleware.
+	ClientCertConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+		// SuccessHandler defines a function which is executed for a valid certificate before middleware chain
+		// continues with next middleware or handler.
+		SuccessHandler SuccessHandler
+		// ErrorHandler defines a function which is executed for a missing or rejected certificate.
+		ErrorHandler ErrorHandler
+		// Context key to store the *ClientCertIdentity into context.
+		// Optional. Default value "client_cert".
+		ContextKey string
+		// RootCAs used to verify the client certificate chain.
+		// Optional. When nil the chain verified by the tls.Config of the server is trusted, certificates
+		// received through ForwardedHeader are then rejected.
+		RootCAs *x509.CertPool
+		// AllowedSubjects is an allowlist of subject common names.
+		// Optional.
+		AllowedSubjects []string
+		// AllowedSANs is an allowlist of subject alternative names (dns, email, uri and ip).
+		// Optional.
+		AllowedSANs []string
+		// AllowedFingerprints is an allowlist of hex encoded sha256 fingerprints of the certificate.
+		// Optional.
+		AllowedFingerprints []string
+		// ForwardedHeader is the header a proxy terminating TLS upstream puts the client certificate into.
+		// Both the envoy format (Hash=...;Cert="<url encoded pem>") and a plain url encoded pem
+		// (nginx $ssl_client_escaped_cert) are supported.
+		// Optional. Default value "", the header is ignored. See igin.HeaderXForwardedClientCert.
+		ForwardedHeader string
+		// TrustedProxies are the CIDRs of the proxies allowed to set ForwardedHeader.
+		// Required when ForwardedHeader is set.
+		TrustedProxies []string
+	}
+
+	// ClientCertIdentity is the identity of an authenticated client certificate.
+	ClientCertIdentity struct {
+		Subject        string
+		DNSNames       []string
+		EmailAddresses []string
+		URIs           []string
+		IPAddresses    []string
+		// Fingerprint is the hex encoded sha256 of the certificate.
+		Fingerprint string
+		// Forwarded reports whether the certificate was received through ForwardedHeader.
+		Forwarded   bool
+		Certificate *x509.Certificate
+	}
+)
+
+var (
+	ClientCertContextKey = "client_cert"
+	// DefaultClientCertConfig is the default ClientCert middleware config.
+	defaultClientCertConfig = ClientCertConfig{
+		Skipper:      DefaultSkipper,
+		ErrorHandler: DefaultErrorHandler,
+		ContextKey:   ClientCertContextKey,
+	}
+	ErrClientCertMissing   = xerror.NewHTTPError(http.StatusUnauthorized, "missing client certificate")
+	ErrClientCertInvalid   = xerror.NewHTTPError(http.StatusUnauthorized, "invalid client certificate")
+	ErrClientCertForbidden = xerror.NewHTTPError(http.StatusForbidden, "client certificate not allowed")
+)
+
+// ClientCertNext returns a ClientCert middleware verifying the peer certificate against rootCAs.
+func ClientCertNext(rootCAs *x509.CertPool) gin.HandlerFunc {
+	c := defaultClientCertConfig
+	c.RootCAs = rootCAs
+	return ClientCertNextWithConfig(c)
+}
+
+// ContextClientCert returns the identity stored by the ClientCert middleware,
+// pass contextKey when the middleware is configured with a custom ContextKey.
+func ContextClientCert(c *gin.Context, contextKey ...string) (*ClientCertIdentity, error) {
+	key := ClientCertContextKey
+	if len(contextKey) > 0 && contextKey[0] != "" {
+		key = contextKey[0]
+	}
+	if value, exists := c.Get(key); exists {
+		if identity, ok := value.(*ClientCertIdentity); ok {
+			return identity, nil
+		}
+	}
+	return nil, errors.New("client certificate information does not exist")
+}
+
+// ClientCertNextWithConfig returns a ClientCert middleware with config.
+func ClientCertNextWithConfig(config ClientCertConfig) gin.HandlerFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = defaultClientCertConfig.Skipper
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = defaultClientCertConfig.ErrorHandler
+	}
+	if config.ContextKey == "" {
+		config.ContextKey = defaultClientCertConfig.ContextKey
+	}
+	var trustedProxies []*net.IPNet
+	if config.ForwardedHeader != "" {
+		if len(config.TrustedProxies) == 0 {
+			panic("IGin: client-cert middleware requires trusted proxies to read " + config.ForwardedHeader)
+		}
+		var err error
+		if trustedProxies, err = ParseCIDRs(config.TrustedProxies); err != nil {
+			panic(err)
+		}
+	}
+	fingerprints := make([]string, 0, len(config.AllowedFingerprints))
+	for _, fingerprint := range config.AllowedFingerprints {
+		fingerprints = append(fingerprints, strings.ToLower(strings.ReplaceAll(fingerprint, ":", "")))
+	}
+	return func(c *gin.Context) {
+		if config.Skipper(c) {
+			c.Next()
+			return
+		}
+		var certs []*x509.Certificate
+		verified := false
+		forwarded := false
+		if c.Request.TLS != nil && len(c.Request.TLS.PeerCertificates) > 0 {
+			certs = c.Request.TLS.PeerCertificates
+			verified = len(c.Request.TLS.VerifiedChains) > 0
+		} else if config.ForwardedHeader != "" && containsIP(trustedProxies, net.ParseIP(c.RemoteIP())) {
+			if value := c.Request.Header.Get(config.ForwardedHeader); value != "" {
+				cert, err := parseForwardedClientCert(value)
+				if err != nil {
+					config.ErrorHandler(c, ErrClientCertInvalid, ErrClientCertInvalid.Code)
+					return
+				}
+				certs = []*x509.Certificate{cert}
+				forwarded = true
+			}
+		}
+		if len(certs) == 0 {
+			config.ErrorHandler(c, ErrClientCertMissing, ErrClientCertMissing.Code)
+			return
+		}
+		if config.RootCAs != nil {
+			opts := x509.VerifyOptions{
+				Roots:         config.RootCAs,
+				Intermediates: x509.NewCertPool(),
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			}
+			for _, cert := range certs[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			if _, err := certs[0].Verify(opts); err != nil {
+				config.ErrorHandler(c, ErrClientCertInvalid, ErrClientCertInvalid.Code)
+				return
+			}
+		} else if !verified {
+			config.ErrorHandler(c, ErrClientCertInvalid, ErrClientCertInvalid.Code)
+			return
+		}
+		identity := newClientCertIdentity(certs[0], forwarded)
+		if !identity.allowed(config.AllowedSubjects, config.AllowedSANs, fingerprints) {
+			config.ErrorHandler(c, ErrClientCertForbidden, ErrClientCertForbidden.Code)
+			return
+		}
+		c.Set(config.ContextKey, identity)
+		if config.SuccessHandler != nil {
+			config.SuccessHandler(c)
+		}
+		c.Next()
+	}
+}
+
+func newClientCertIdentity(cert *x509.Certificate, forwarded bool) *ClientCertIdentity {
+	sum := sha256.Sum256(cert.Raw)
+	identity := &ClientCertIdentity{
+		Subject:        cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		Fingerprint:    hex.EncodeToString(sum[:]),
+		Forwarded:      forwarded,
+		Certificate:    cert,
+	}
+	for _, uri := range cert.URIs {
+		identity.URIs = append(identity.URIs, uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		identity.IPAddresses = append(identity.IPAddresses, ip.String())
+	}
+	return identity
+}
+
+// allowed reports whether the identity passes every configured allowlist.
+func (i *ClientCertIdentity) allowed(subjects, sans, fingerprints []string) bool {
+	if len(subjects) > 0 && !xT.Contains(subjects, i.Subject) {
+		return false
+	}
+	if len(sans) > 0 {
+		match := false
+		for _, names := range [][]string{i.DNSNames, i.EmailAddresses, i.URIs, i.IPAddresses} {
+			for _, name := range names {
+				if xT.Contains(sans, name) {
+					match = true
+				}
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	if len(fingerprints) > 0 && !xT.Contains(fingerprints, i.Fingerprint) {
+		return false
+	}
+	return true
+}
+
+// parseForwardedClientCert parses a certificate forwarded by a proxy, either in the envoy
+// X-Forwarded-Client-Cert format or as a url encoded pem.
+func parseForwardedClientCert(value string) (*x509.Certificate, error) {
+	// envoy: By=...;Hash=...;Cert="<url encoded pem>";Subject="..."
+	// only the first element is used, it is the one added by the proxy closest to the client
+	if element, _, _ := strings.Cut(value, ","); strings.Contains(element, "Cert=") {
+		for _, pair := range strings.Split(element, ";") {
+			k, v, _ := strings.Cut(pair, "=")
+			if strings.EqualFold(strings.TrimSpace(k), "Cert") {
+				value = strings.Trim(v, `"`)
+				break
+			}
+		}
+	}
+	unescaped, err := url.QueryUnescape(value)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode([]byte(unescaped)); block != nil {
+		return x509.ParseCertificate(block.Bytes)
+	}
+	der, err := base64.StdEncoding.DecodeString(unescaped)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// ParseCIDRs parses CIDRs, a bare ip is treated as a single host network.
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: cidr}
+			}
+			if ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
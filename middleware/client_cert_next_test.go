@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+func (ca *testCA) issue(t *testing.T, commonName string, dnsNames ...string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func clientCertEngine(config ClientCertConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.Use(ClientCertNextWithConfig(config))
+	g.GET("/", func(c *gin.Context) {
+		identity, err := ContextClientCert(c, config.ContextKey)
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		forwarded := ""
+		if identity.Forwarded {
+			forwarded = " forwarded"
+		}
+		c.String(http.StatusOK, identity.Subject+forwarded)
+	})
+	return g
+}
+
+func serveClientCert(g *gin.Engine, cert *x509.Certificate, remoteAddr string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cert != nil {
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	}
+	if remoteAddr != "" {
+		req.RemoteAddr = remoteAddr
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	return w
+}
+
+func TestClientCertNext(t *testing.T) {
+	ca, other := newTestCA(t), newTestCA(t)
+	client := ca.issue(t, "client", "client.internal")
+	g := clientCertEngine(ClientCertConfig{RootCAs: ca.pool, ContextKey: "identity"})
+
+	w := serveClientCert(g, client, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "client", w.Body.String(), "identity is read with the configured context key")
+
+	assert.Equal(t, http.StatusUnauthorized, serveClientCert(g, other.issue(t, "client"), "").Code, "signed by another ca")
+	assert.Equal(t, http.StatusUnauthorized, serveClientCert(g, nil, "").Code)
+
+	unverified := clientCertEngine(ClientCertConfig{})
+	assert.Equal(t, http.StatusUnauthorized, serveClientCert(unverified, client, "").Code,
+		"without RootCAs the chain must have been verified by the server")
+}
+
+func TestClientCertAllowlists(t *testing.T) {
+	ca := newTestCA(t)
+	client, intruder := ca.issue(t, "client", "client.internal"), ca.issue(t, "intruder", "intruder.internal")
+	identity := newClientCertIdentity(client, false)
+
+	for name, config := range map[string]ClientCertConfig{
+		"subject":     {RootCAs: ca.pool, AllowedSubjects: []string{"client"}},
+		"san":         {RootCAs: ca.pool, AllowedSANs: []string{"client.internal"}},
+		"fingerprint": {RootCAs: ca.pool, AllowedFingerprints: []string{identity.Fingerprint}},
+	} {
+		g := clientCertEngine(config)
+		assert.Equal(t, http.StatusOK, serveClientCert(g, client, "").Code, name)
+		assert.Equal(t, http.StatusForbidden, serveClientCert(g, intruder, "").Code, name)
+	}
+}
+
+func TestClientCertForwarded(t *testing.T) {
+	ca := newTestCA(t)
+	client := ca.issue(t, "client")
+	escaped := url.QueryEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: client.Raw})))
+	g := clientCertEngine(ClientCertConfig{
+		RootCAs:         ca.pool,
+		ForwardedHeader: igin.HeaderXForwardedClientCert,
+		TrustedProxies:  []string{"10.0.0.0/8"},
+	})
+
+	w := serveClientCert(g, nil, "10.0.0.1:1234", igin.HeaderXForwardedClientCert, `Hash=abc;Cert="`+escaped+`"`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "client forwarded", w.Body.String())
+	w = serveClientCert(g, nil, "10.0.0.1:1234", igin.HeaderXForwardedClientCert, escaped)
+	assert.Equal(t, http.StatusOK, w.Code, "plain url encoded pem")
+
+	w = serveClientCert(g, nil, "192.0.2.1:1234", igin.HeaderXForwardedClientCert, escaped)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "header from an untrusted peer is ignored")
+
+	assert.Panics(t, func() {
+		ClientCertNextWithConfig(ClientCertConfig{ForwardedHeader: igin.HeaderXForwardedClientCert})
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pkg6/igin"
@@ -109,6 +110,15 @@ type CORSConfig struct {
 	// See also: https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Access-Control-Max-Age
 	MaxAge int
 
+	// AllowPrivateNetwork answers Private Network Access preflight requests carrying
+	// `Access-Control-Request-Private-Network: true` with `Access-Control-Allow-Private-Network: true`,
+	// allowing public websites to reach the server on a private network.
+	//
+	// Optional. Default value false.
+	//
+	// See also: https://wicg.github.io/private-network-access/
+	AllowPrivateNetwork bool
+
 	ErrorHandler ErrorHandler
 }
 
@@ -188,13 +198,13 @@ func CORSNextWithConfig(config CORSConfig) gin.HandlerFunc {
 		hasCustomAllowMethods = false
 		config.AllowMethods = defaultCORSConfig.AllowMethods
 	}
-	var allowOriginPatterns []string
+	var allowOriginPatterns []*regexp.Regexp
 	for _, origin := range config.AllowOrigins {
 		pattern := regexp.QuoteMeta(origin)
 		pattern = strings.ReplaceAll(pattern, "\\*", ".*")
 		pattern = strings.ReplaceAll(pattern, "\\?", ".")
 		pattern = "^" + pattern + "$"
-		allowOriginPatterns = append(allowOriginPatterns, pattern)
+		allowOriginPatterns = append(allowOriginPatterns, regexp.MustCompile(pattern))
 	}
 	allowMethods := strings.Join(config.AllowMethods, ",")
 	allowHeaders := strings.Join(config.AllowHeaders, ",")
@@ -208,7 +218,7 @@ func CORSNextWithConfig(config CORSConfig) gin.HandlerFunc {
 		req := c.Request
 		origin := c.Request.Header.Get(igin.HeaderOrigin)
 		allowOrigin := ""
-		c.Header(igin.HeaderVary, igin.HeaderOrigin)
+		AddVary(c, igin.HeaderOrigin)
 		preflight := req.Method == http.MethodOptions
 		routerAllowMethods := ""
 		if preflight {
@@ -263,7 +273,7 @@ func CORSNextWithConfig(config CORSConfig) gin.HandlerFunc {
 			}
 			if checkPatterns {
 				for _, re := range allowOriginPatterns {
-					if match, _ := regexp.MatchString(re, origin); match {
+					if re.MatchString(origin) {
 						allowOrigin = origin
 						break
 					}
@@ -292,8 +302,7 @@ func CORSNextWithConfig(config CORSConfig) gin.HandlerFunc {
 			return
 		}
 		// Preflight
-		c.Header(igin.HeaderVary, igin.HeaderAccessControlRequestMethod)
-		c.Header(igin.HeaderVary, igin.HeaderAccessControlRequestHeaders)
+		AddVary(c, igin.HeaderAccessControlRequestMethod, igin.HeaderAccessControlRequestHeaders)
 		if !hasCustomAllowMethods && routerAllowMethods != "" {
 			c.Header(igin.HeaderAccessControlAllowMethods, routerAllowMethods)
 		} else {
@@ -310,6 +319,51 @@ func CORSNextWithConfig(config CORSConfig) gin.HandlerFunc {
 		if config.MaxAge > 0 {
 			c.Header(igin.HeaderAccessControlMaxAge, maxAge)
 		}
+		if config.AllowPrivateNetwork {
+			AddVary(c, igin.HeaderAccessControlRequestPrivateNetwork)
+			if req.Header.Get(igin.HeaderAccessControlRequestPrivateNetwork) == "true" {
+				c.Header(igin.HeaderAccessControlAllowPrivateNetwork, "true")
+			}
+		}
 		c.AbortWithStatus(http.StatusNoContent)
 	}
 }
+
+// CORSPolicies holds named CORS policies, so routes and controllers can pick one:
+//
+//	policies := middleware.NewCORSPolicies().
+//		Register("public", middleware.CORSConfig{AllowOrigins: []string{"*"}})
+//	g.GET("/feed", policies.Next("public"), feed)
+//	g.OPTIONS("/feed", policies.Next("public"))
+//
+// Preflight requests only reach the policy when an OPTIONS route is registered for the path.
+type CORSPolicies struct {
+	mu       sync.RWMutex
+	policies map[string]gin.HandlerFunc
+}
+
+// NewCORSPolicies returns an empty set of CORS policies.
+func NewCORSPolicies() *CORSPolicies {
+	return &CORSPolicies{policies: map[string]gin.HandlerFunc{}}
+}
+
+// Register registers a named CORS policy, the config is compiled once.
+// Registering a name again replaces the policy for middleware created afterwards.
+func (p *CORSPolicies) Register(name string, config CORSConfig) *CORSPolicies {
+	handler := CORSNextWithConfig(config)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.policies[name] = handler
+	return p
+}
+
+// Next returns the CORS middleware of a registered policy, it panics on unknown policies.
+func (p *CORSPolicies) Next(name string) gin.HandlerFunc {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	handler, ok := p.policies[name]
+	if !ok {
+		panic("IGin: unknown cors policy " + name)
+	}
+	return handler
+}
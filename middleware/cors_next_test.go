@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORSPolicyNext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	policies := NewCORSPolicies().
+		Register("private", CORSConfig{AllowOrigins: []string{"https://*.example.com"}, AllowPrivateNetwork: true}).
+		Register("public", CORSConfig{AllowOrigins: []string{"*"}})
+	g := gin.New()
+	g.Use(func(c *gin.Context) {
+		AddVary(c, igin.HeaderAcceptEncoding)
+	})
+	g.GET("/private", policies.Next("private"), func(c *gin.Context) {})
+	g.OPTIONS("/private", policies.Next("private"))
+	g.GET("/public", policies.Next("public"), func(c *gin.Context) {})
+
+	serve := func(method, path, origin string, headers ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set(igin.HeaderOrigin, origin)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		g.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(http.MethodGet, "/private", "https://app.example.com")
+	assert.Equal(t, "https://app.example.com", w.Header().Get(igin.HeaderAccessControlAllowOrigin))
+	assert.Equal(t, []string{igin.HeaderAcceptEncoding, igin.HeaderOrigin}, w.Header().Values(igin.HeaderVary))
+
+	w = serve(http.MethodGet, "/private", "https://evil.com")
+	assert.Empty(t, w.Header().Get(igin.HeaderAccessControlAllowOrigin))
+
+	w = serve(http.MethodOptions, "/private", "https://app.example.com",
+		igin.HeaderAccessControlRequestMethod, http.MethodGet,
+		igin.HeaderAccessControlRequestPrivateNetwork, "true")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "true", w.Header().Get(igin.HeaderAccessControlAllowPrivateNetwork))
+	assert.Contains(t, w.Header().Values(igin.HeaderVary), igin.HeaderAccessControlRequestPrivateNetwork)
+
+	w = serve(http.MethodGet, "/public", "https://evil.com")
+	assert.Equal(t, "*", w.Header().Get(igin.HeaderAccessControlAllowOrigin))
+
+	assert.Panics(t, func() { policies.Next("unknown") })
+	assert.Panics(t, func() { NewCORSPolicies().Next("public") }, "policies are not shared")
+}
@@ -0,0 +1,314 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+)
+
+// CSP directives
+const (
+	CSPDefaultSrc              = "default-src"
+	CSPScriptSrc               = "script-src"
+	CSPStyleSrc                = "style-src"
+	CSPImgSrc                  = "img-src"
+	CSPConnectSrc              = "connect-src"
+	CSPFontSrc                 = "font-src"
+	CSPObjectSrc               = "object-src"
+	CSPMediaSrc                = "media-src"
+	CSPFrameSrc                = "frame-src"
+	CSPWorkerSrc               = "worker-src"
+	CSPManifestSrc             = "manifest-src"
+	CSPFrameAncestors          = "frame-ancestors"
+	CSPBaseURI                 = "base-uri"
+	CSPFormAction              = "form-action"
+	CSPReportURI               = "report-uri"
+	CSPReportTo                = "report-to"
+	CSPUpgradeInsecureRequests = "upgrade-insecure-requests"
+)
+
+// CSP sources
+const (
+	CSPSelf          = "'self'"
+	CSPNone          = "'none'"
+	CSPUnsafeInline  = "'unsafe-inline'"
+	CSPUnsafeEval    = "'unsafe-eval'"
+	CSPStrictDynamic = "'strict-dynamic'"
+	CSPData          = "data:"
+	CSPBlob          = "blob:"
+	CSPHTTPS         = "https:"
+	// CSPNonce is replaced by the 'nonce-<value>' of the request.
+	CSPNonce = "'nonce'"
+)
+
+type (
+	// CSP is a Content-Security-Policy builder, directives are rendered in the order they were added.
+	//
+	//	middleware.NewCSP().DefaultSrc(middleware.CSPSelf).ScriptSrc(middleware.CSPNonce, middleware.CSPStrictDynamic)
+	CSP struct {
+		directives []cspDirective
+		// endpoints of the Reporting-Endpoints header by group.
+		endpoints []cspDirective
+	}
+
+	cspDirective struct {
+		name    string
+		sources []string
+	}
+
+	// CSPReport is a violation report sent by the browser, see CSPReportHandler.
+	CSPReport struct {
+		DocumentURI        string `json:"document-uri"`
+		Referrer           string `json:"referrer"`
+		BlockedURI         string `json:"blocked-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		OriginalPolicy     string `json:"original-policy"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"source-file"`
+		LineNumber         int    `json:"line-number"`
+		ColumnNumber       int    `json:"column-number"`
+		StatusCode         int    `json:"status-code"`
+		ScriptSample       string `json:"script-sample"`
+	}
+
+	// cspReportBody is the body of a Reporting API "csp-violation" report.
+	cspReportBody struct {
+		DocumentURL        string `json:"documentURL"`
+		Referrer           string `json:"referrer"`
+		BlockedURL         string `json:"blockedURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		OriginalPolicy     string `json:"originalPolicy"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"sourceFile"`
+		LineNumber         int    `json:"lineNumber"`
+		ColumnNumber       int    `json:"columnNumber"`
+		StatusCode         int    `json:"statusCode"`
+		Sample             string `json:"sample"`
+	}
+)
+
+var (
+	CSPNonceContextKey = "csp_nonce"
+	// cspReportMaxSize limits the size of violation reports.
+	cspReportMaxSize int64 = 64 << 10
+)
+
+// NewCSP returns an empty CSP builder.
+func NewCSP() *CSP {
+	return &CSP{}
+}
+
+// Add appends sources to directive, adding the directive when missing.
+func (p *CSP) Add(directive string, sources ...string) *CSP {
+	for i := range p.directives {
+		if p.directives[i].name == directive {
+			p.directives[i].sources = append(p.directives[i].sources, sources...)
+			return p
+		}
+	}
+	p.directives = append(p.directives, cspDirective{name: directive, sources: sources})
+	return p
+}
+
+func (p *CSP) DefaultSrc(sources ...string) *CSP {
+	return p.Add(CSPDefaultSrc, sources...)
+}
+
+func (p *CSP) ScriptSrc(sources ...string) *CSP {
+	return p.Add(CSPScriptSrc, sources...)
+}
+
+func (p *CSP) StyleSrc(sources ...string) *CSP {
+	return p.Add(CSPStyleSrc, sources...)
+}
+
+func (p *CSP) ImgSrc(sources ...string) *CSP {
+	return p.Add(CSPImgSrc, sources...)
+}
+
+func (p *CSP) ConnectSrc(sources ...string) *CSP {
+	return p.Add(CSPConnectSrc, sources...)
+}
+
+func (p *CSP) FontSrc(sources ...string) *CSP {
+	return p.Add(CSPFontSrc, sources...)
+}
+
+func (p *CSP) ObjectSrc(sources ...string) *CSP {
+	return p.Add(CSPObjectSrc, sources...)
+}
+
+func (p *CSP) FrameAncestors(sources ...string) *CSP {
+	return p.Add(CSPFrameAncestors, sources...)
+}
+
+func (p *CSP) BaseURI(sources ...string) *CSP {
+	return p.Add(CSPBaseURI, sources...)
+}
+
+func (p *CSP) FormAction(sources ...string) *CSP {
+	return p.Add(CSPFormAction, sources...)
+}
+
+// UpgradeInsecureRequests adds the upgrade-insecure-requests directive.
+func (p *CSP) UpgradeInsecureRequests() *CSP {
+	return p.Add(CSPUpgradeInsecureRequests)
+}
+
+// ReportURI sets the deprecated report-uri directive, still the only one supported by some browsers.
+func (p *CSP) ReportURI(uri string) *CSP {
+	return p.Add(CSPReportURI, uri)
+}
+
+// ReportTo sets the report-to directive and the Reporting-Endpoints header entry of group.
+func (p *CSP) ReportTo(group, url string) *CSP {
+	p.endpoints = append(p.endpoints, cspDirective{name: group, sources: []string{url}})
+	return p.Add(CSPReportTo, group)
+}
+
+// UsesNonce reports whether any directive contains CSPNonce.
+func (p *CSP) UsesNonce() bool {
+	for _, directive := range p.directives {
+		for _, source := range directive.sources {
+			if source == CSPNonce {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// String returns the policy with CSPNonce left as is.
+func (p *CSP) String() string {
+	return p.Build("")
+}
+
+// Build returns the policy, CSPNonce sources are replaced by 'nonce-<nonce>' when nonce is not empty.
+func (p *CSP) Build(nonce string) string {
+	var b strings.Builder
+	for i, directive := range p.directives {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(directive.name)
+		for _, source := range directive.sources {
+			if source == CSPNonce && nonce != "" {
+				source = "'nonce-" + nonce + "'"
+			}
+			b.WriteByte(' ')
+			b.WriteString(source)
+		}
+	}
+	return b.String()
+}
+
+// ReportingEndpoints returns the Reporting-Endpoints header value for the ReportTo groups.
+func (p *CSP) ReportingEndpoints() string {
+	endpoints := make([]string, 0, len(p.endpoints))
+	for _, endpoint := range p.endpoints {
+		endpoints = append(endpoints, endpoint.name+"="+strconv.Quote(endpoint.sources[0]))
+	}
+	return strings.Join(endpoints, ", ")
+}
+
+// ContextCSPNonce returns the nonce of the request generated by the Secure middleware.
+func ContextCSPNonce(c *gin.Context) string {
+	return c.GetString(CSPNonceContextKey)
+}
+
+// CSPFuncMap returns the "csp_nonce" template function, register it with igin.Engine.SetFuncMaps.
+//
+//	<script nonce="{{ csp_nonce }}">...</script>
+func CSPFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"csp_nonce": igin.ContextFunc(func(c *gin.Context) any {
+			return func() string {
+				return ContextCSPNonce(c)
+			}
+		}),
+	}
+}
+
+// CSPReportHandler returns a handler receiving violation reports and forwarding them to fn.
+// Both the report-uri format ("application/csp-report") and the Reporting API format
+// ("application/reports+json") are accepted, the handler responds with 204.
+func CSPReportHandler(fn func(c *gin.Context, report CSPReport)) gin.HandlerFunc {
+	if fn == nil {
+		panic("IGin: csp report handler requires a callback")
+	}
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, cspReportMaxSize))
+		if err != nil {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		reports, err := parseCSPReports(body)
+		if err != nil {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		for _, report := range reports {
+			fn(c, report)
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func parseCSPReports(body []byte) ([]CSPReport, error) {
+	body = []byte(strings.TrimSpace(string(body)))
+	if len(body) > 0 && body[0] == '[' {
+		var items []struct {
+			Type string        `json:"type"`
+			Body cspReportBody `json:"body"`
+		}
+		if err := json.Unmarshal(body, &items); err != nil {
+			return nil, err
+		}
+		reports := make([]CSPReport, 0, len(items))
+		for _, item := range items {
+			if item.Type != "csp-violation" {
+				continue
+			}
+			reports = append(reports, CSPReport{
+				DocumentURI:        item.Body.DocumentURL,
+				Referrer:           item.Body.Referrer,
+				BlockedURI:         item.Body.BlockedURL,
+				ViolatedDirective:  item.Body.EffectiveDirective,
+				EffectiveDirective: item.Body.EffectiveDirective,
+				OriginalPolicy:     item.Body.OriginalPolicy,
+				Disposition:        item.Body.Disposition,
+				SourceFile:         item.Body.SourceFile,
+				LineNumber:         item.Body.LineNumber,
+				ColumnNumber:       item.Body.ColumnNumber,
+				StatusCode:         item.Body.StatusCode,
+				ScriptSample:       item.Body.Sample,
+			})
+		}
+		return reports, nil
+	}
+	var legacy struct {
+		Report CSPReport `json:"csp-report"`
+	}
+	if err := json.Unmarshal(body, &legacy); err != nil {
+		return nil, err
+	}
+	return []CSPReport{legacy.Report}, nil
+}
+
+// newCSPNonce returns a base64url nonce, its characters need no escaping in html attributes.
+func newCSPNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSP(t *testing.T) {
+	policy := NewCSP().DefaultSrc(CSPSelf).ScriptSrc(CSPNonce, CSPStrictDynamic).ObjectSrc(CSPNone).
+		ReportURI("/csp").ReportTo("csp", "https://example.com/csp")
+	assert.Equal(t, "default-src 'self'; script-src 'nonce-abc' 'strict-dynamic'; object-src 'none'; report-uri /csp; report-to csp", policy.Build("abc"))
+	assert.Equal(t, `csp="https://example.com/csp"`, policy.ReportingEndpoints())
+	assert.True(t, policy.UsesNonce())
+
+	gin.SetMode(gin.TestMode)
+	g := igin.New()
+	g.SetFuncMaps(CSPFuncMap())
+	g.SetHTMLTemplate(template.Must(template.New("page").Funcs(g.FuncMap).Parse(`<script nonce="{{ csp_nonce }}"></script>`)))
+	g.Use(SecureNextWithConfig(SecureConfig{CSP: policy}))
+	g.GET("/", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "page", nil)
+	})
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	nonce := strings.TrimSuffix(strings.TrimPrefix(w.Body.String(), `<script nonce="`), `"></script>`)
+	assert.NotEmpty(t, nonce)
+	assert.Contains(t, w.Header().Get(igin.HeaderContentSecurityPolicy), "'nonce-"+nonce+"'")
+	assert.Equal(t, `csp="https://example.com/csp"`, w.Header().Get(igin.HeaderReportingEndpoints))
+}
+
+func TestCSPReportHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var reports []CSPReport
+	g := gin.New()
+	g.POST("/csp", CSPReportHandler(func(c *gin.Context, report CSPReport) {
+		reports = append(reports, report)
+	}))
+	for _, body := range []string{
+		`{"csp-report":{"document-uri":"https://example.com/","blocked-uri":"inline","violated-directive":"script-src"}}`,
+		`[{"type":"csp-violation","body":{"documentURL":"https://example.com/","blockedURL":"inline","effectiveDirective":"script-src"}},{"type":"deprecation","body":{}}]`,
+	} {
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/csp", strings.NewReader(body)))
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	}
+	assert.Len(t, reports, 2)
+	for _, report := range reports {
+		assert.Equal(t, "https://example.com/", report.DocumentURI)
+		assert.Equal(t, "inline", report.BlockedURI)
+		assert.Equal(t, "script-src", report.ViolatedDirective)
+	}
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/csp", strings.NewReader("nope")))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
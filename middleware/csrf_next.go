@@ -1,14 +1,20 @@
 package middleware
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/base64"
 	"fmt"
-	"github.com/pkg6/igin/xerror"
-	"github.com/pkg6/igin/xstring"
 	"html/template"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
+	"github.com/pkg6/igin/xerror"
+
 	"github.com/gin-gonic/gin"
 	"github.com/pkg6/igin"
 )
@@ -57,6 +63,20 @@ type (
 		CookieSameSite http.SameSite
 		// ErrorHandler defines a function which is executed for returning custom errors.
 		ErrorHandler ErrorHandler
+		// Secret enables signed tokens: the cookie token carries an HMAC of a random nonce and the session binding,
+		// so tokens injected into the cookie (e.g. from a subdomain) are rejected.
+		// Optional. Default value nil, plain random tokens.
+		Secret []byte
+		// SessionBinding returns the value signed tokens are bound to, usually the session id.
+		// A token issued for another session is rejected. See session.CSRFBinding.
+		// Optional. Default value nil, tokens are not bound.
+		SessionBinding func(c *gin.Context) string
+		// TrustedOrigins are origins besides the request host allowed to send unsafe requests,
+		// e.g. "https://app.example.com" or "https://*.example.com".
+		// The Origin header, or the Referer header when Origin is missing, is checked for unsafe methods.
+		// Requests without both headers are not browser requests and only the token is checked.
+		// Optional. Default value none.
+		TrustedOrigins []string
 	}
 )
 
@@ -74,6 +94,7 @@ var (
 		ErrorHandler:   DefaultErrorHandler,
 	}
 	ErrCSRFInvalid = xerror.NewHTTPError(http.StatusForbidden, "invalid csrf token")
+	ErrCSRFOrigin  = xerror.NewHTTPError(http.StatusForbidden, "untrusted csrf origin")
 )
 
 // CSRFNext returns a Cross-Site Request Forgery (CSRF) middleware.
@@ -91,6 +112,30 @@ func CSRFFormHTML(c *gin.Context, inputTypes ...string) template.HTML {
 	return template.HTML(fmt.Sprintf("<input type=\"%s\" name=\"%s\" value=\"%s\">", inputType, igin.HeaderXCSRFToken, c.GetString(CSRFContextKey)))
 }
 
+// CSRFFuncMap returns the "csrf_token" and "csrf_field" template functions, register it with igin.Engine.SetFuncMaps.
+//
+//	<form method="post">{{ csrf_field }}</form>
+func CSRFFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"csrf_token": igin.ContextFunc(func(c *gin.Context) any {
+			return func() string {
+				return c.GetString(CSRFContextKey)
+			}
+		}),
+		"csrf_field": igin.ContextFunc(func(c *gin.Context) any {
+			return func() template.HTML {
+				return CSRFFormHTML(c)
+			}
+		}),
+	}
+}
+
+// CSRFTokenHandler responds with a freshly masked token as {"token": "..."} for single page applications.
+// It must be routed behind the CSRF middleware.
+func CSRFTokenHandler(c *gin.Context) {
+	igin.JsonSuccess(c, gin.H{"token": c.GetString(CSRFContextKey)})
+}
+
 // CSRFNextWithConfig returns a CSRF middleware with config.
 // See `CSRF()`.
 func CSRFNextWithConfig(config CSRFConfig) gin.HandlerFunc {
@@ -128,16 +173,22 @@ func CSRFNextWithConfig(config CSRFConfig) gin.HandlerFunc {
 			c.Next()
 			return
 		}
-		token := ""
-		if k, err := c.Cookie(config.CookieName); err != nil {
-			token = xstring.RandomN(config.TokenLength)
-		} else {
-			token = k
+		binding := ""
+		if config.SessionBinding != nil {
+			binding = config.SessionBinding(c)
+		}
+		token, err := c.Cookie(config.CookieName)
+		if err != nil || token == "" || (config.Secret != nil && !validSignedCSRFToken(config.Secret, binding, token)) {
+			token = newCSRFToken(config.Secret, binding, config.TokenLength)
 		}
 		switch c.Request.Method {
 		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
 		default:
 			// Validate token only for requests which are not defined as 'safe' by RFC7231
+			if !trustedCSRFOrigin(c, config.TrustedOrigins) {
+				config.ErrorHandler(c, ErrCSRFOrigin, ErrCSRFOrigin.Code)
+				return
+			}
 			var lastExtractorErr error
 			var lastTokenErr error
 		outer:
@@ -173,7 +224,7 @@ func CSRFNextWithConfig(config CSRFConfig) gin.HandlerFunc {
 				finalErr = lastExtractorErr
 			}
 			if finalErr != nil {
-				config.ErrorHandler(c, finalErr)
+				config.ErrorHandler(c, finalErr, finalErr.(*xerror.HTTPError).Code)
 				return
 			}
 		}
@@ -194,13 +245,113 @@ func CSRFNextWithConfig(config CSRFConfig) gin.HandlerFunc {
 		cookie.Secure = config.CookieSecure
 		cookie.HttpOnly = config.CookieHTTPOnly
 		http.SetCookie(c.Writer, cookie)
-		c.Set(config.ContextKey, token)
-		c.Header(igin.HeaderVary, igin.HeaderCookie)
+		// mask the token per response to mitigate BREACH
+		c.Set(config.ContextKey, maskCSRFToken(token))
+		AddVary(c, igin.HeaderCookie)
 		c.Next()
 	}
 
 }
 
+// validateCSRFToken accepts masked and raw client tokens.
 func validateCSRFToken(token, clientToken string) bool {
+	if unmasked, ok := unmaskCSRFToken(clientToken); ok && subtle.ConstantTimeCompare([]byte(token), unmasked) == 1 {
+		return true
+	}
 	return subtle.ConstantTimeCompare([]byte(token), []byte(clientToken)) == 1
 }
+
+// newCSRFToken returns a random token, signed as "<nonce>.<hmac>" when secret is set.
+func newCSRFToken(secret []byte, binding string, length int) string {
+	b := make([]byte, length)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(b)[:length]
+	if secret == nil {
+		return nonce
+	}
+	return nonce + "." + signCSRFToken(secret, binding, nonce)
+}
+
+func signCSRFToken(secret []byte, binding, nonce string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(binding))
+	mac.Write([]byte{0})
+	mac.Write([]byte(nonce))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func validSignedCSRFToken(secret []byte, binding, token string) bool {
+	nonce, signature, ok := strings.Cut(token, ".")
+	return ok && hmac.Equal([]byte(signature), []byte(signCSRFToken(secret, binding, nonce)))
+}
+
+// maskCSRFToken returns base64(pad + token XOR pad) with a random pad, so the token differs in every response.
+func maskCSRFToken(token string) string {
+	b := make([]byte, 2*len(token))
+	if _, err := rand.Read(b[:len(token)]); err != nil {
+		panic(err)
+	}
+	for i := 0; i < len(token); i++ {
+		b[len(token)+i] = token[i] ^ b[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func unmaskCSRFToken(masked string) ([]byte, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(masked)
+	if err != nil || len(b) == 0 || len(b)%2 != 0 {
+		return nil, false
+	}
+	n := len(b) / 2
+	token := make([]byte, n)
+	for i := 0; i < n; i++ {
+		token[i] = b[n+i] ^ b[i]
+	}
+	return token, true
+}
+
+// trustedCSRFOrigin checks the Origin header, or the Referer header when Origin is missing, against the
+// request host and the trusted origins.
+func trustedCSRFOrigin(c *gin.Context, trustedOrigins []string) bool {
+	origin := c.GetHeader(igin.HeaderOrigin)
+	if origin == "" {
+		referer := c.GetHeader(igin.HeaderReferer)
+		if referer == "" {
+			return true
+		}
+		u, err := url.Parse(referer)
+		if err != nil || u.Host == "" {
+			return false
+		}
+		origin = u.Scheme + "://" + u.Host
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		// "null" origins of sandboxed documents and privacy redirects are not trusted
+		return false
+	}
+	if strings.EqualFold(u.Host, c.Request.Host) {
+		return true
+	}
+	for _, trusted := range trustedOrigins {
+		if matchCSRFOrigin(trusted, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchCSRFOrigin(pattern, origin string) bool {
+	if strings.EqualFold(pattern, origin) {
+		return true
+	}
+	scheme, host, ok := strings.Cut(pattern, "://*.")
+	if !ok {
+		return false
+	}
+	prefix := strings.ToLower(scheme) + "://"
+	origin = strings.ToLower(origin)
+	return strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, "."+strings.ToLower(host))
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSRFNextWithConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	binding := "session-1"
+	g := gin.New()
+	g.Use(CSRFNextWithConfig(CSRFConfig{
+		TokenLookup:    "header:" + igin.HeaderXCSRFToken,
+		Secret:         []byte("secret"),
+		SessionBinding: func(c *gin.Context) string { return binding },
+		TrustedOrigins: []string{"https://*.example.com"},
+	}))
+	g.GET("/token", CSRFTokenHandler)
+	g.POST("/", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	fetch := func(cookie *http.Cookie) (string, *http.Cookie) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/token", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		g.ServeHTTP(w, req)
+		var body struct {
+			Data struct{ Token string }
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body.Data.Token, w.Result().Cookies()[0]
+	}
+	post := func(cookie *http.Cookie, token, origin string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.AddCookie(cookie)
+		req.Header.Set(igin.HeaderXCSRFToken, token)
+		if origin != "" {
+			req.Header.Set(igin.HeaderOrigin, origin)
+		}
+		g.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	token, cookie := fetch(nil)
+	again, _ := fetch(cookie)
+	assert.NotEqual(t, token, again, "tokens are masked per response")
+	assert.NotEqual(t, cookie.Value, token)
+
+	assert.Equal(t, http.StatusOK, post(cookie, token, ""))
+	assert.Equal(t, http.StatusOK, post(cookie, again, "http://example.com"), "same host")
+	assert.Equal(t, http.StatusOK, post(cookie, token, "https://app.example.com"))
+	assert.Equal(t, http.StatusForbidden, post(cookie, token, "https://evil.com"))
+	assert.Equal(t, http.StatusForbidden, post(cookie, "wrong", ""))
+
+	injected := &http.Cookie{Name: cookie.Name, Value: "attacker"}
+	assert.Equal(t, http.StatusForbidden, post(injected, "attacker", ""), "unsigned cookies are rejected")
+
+	binding = "session-2"
+	assert.Equal(t, http.StatusForbidden, post(cookie, token, ""), "tokens are bound to the session")
+}
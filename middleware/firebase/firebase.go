@@ -1,21 +1,53 @@
 package firebase
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	firebase "firebase.google.com/go"
 	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
 	"github.com/pkg6/go-requests"
 	"google.golang.org/api/option"
 )
 
+// EmulatorHostEnv is the environment variable conventionally pointing to the Firebase Auth emulator,
+// e.g. "127.0.0.1:9099". It is not read implicitly, pass it to NewEmulatorAuthClient.
+const EmulatorHostEnv = "FIREBASE_AUTH_EMULATOR_HOST"
+
+// ErrEmulatorUnsupported is the error message of the *auth.Client calls of an emulator AuthClient.
+var ErrEmulatorUnsupported = errors.New("IGin: firebase admin api calls are not supported by the emulator client")
+
+// Verifier verifies firebase tokens. *AuthClient implements it, tests can inject a fake verifier.
+type Verifier interface {
+	VerifyIDToken(ctx context.Context, idToken string) (*auth.Token, error)
+	VerifyIDTokenAndCheckRevoked(ctx context.Context, idToken string) (*auth.Token, error)
+	VerifySessionCookie(ctx context.Context, sessionCookie string) (*auth.Token, error)
+	VerifySessionCookieAndCheckRevoked(ctx context.Context, sessionCookie string) (*auth.Token, error)
+}
+
 type AuthClient struct {
 	ApiKey string
 	Ctx    context.Context
+	// ProjectID of the firebase project.
+	ProjectID string
+	// EmulatorHost of the Auth emulator. When set tokens are verified locally, as the emulator does not sign them,
+	// and the *auth.Client calls fail with ErrEmulatorUnsupported.
+	EmulatorHost string
 	*auth.Client
 }
 
+var _ Verifier = (*AuthClient)(nil)
+
 func newFirebaseApp(ctx context.Context, projectID, credentialsFile string) (*firebase.App, error) {
 	config := &firebase.Config{ProjectID: projectID}
 	app, err := firebase.NewApp(ctx, config, option.WithCredentialsFile(credentialsFile))
@@ -28,8 +60,12 @@ func newFirebaseApp(ctx context.Context, projectID, credentialsFile string) (*fi
 // NewAuthClient
 //projectID && apiKey https://console.firebase.google.com/project/xxxxxx/settings/general?hl=zh-cn
 //credentialsFile https://console.firebase.google.com/project/xxxxxx/settings/serviceaccounts/adminsdk?hl=zh-cn
+// Tokens are always verified against the production keys, use NewEmulatorAuthClient for the emulator.
 func NewAuthClient(projectID, credentialsFile, apiKey string) (*AuthClient, error) {
-	f := &AuthClient{ApiKey: apiKey, Ctx: context.Background()}
+	if os.Getenv(EmulatorHostEnv) != "" {
+		_, _ = fmt.Fprintln(gin.DefaultErrorWriter, "[IGIN-WARNING] "+EmulatorHostEnv+" is ignored by firebase.NewAuthClient, use firebase.NewEmulatorAuthClient to verify unsigned emulator tokens.")
+	}
+	f := &AuthClient{ApiKey: apiKey, Ctx: context.Background(), ProjectID: projectID}
 	firebaseApp, err := newFirebaseApp(f.Ctx, projectID, credentialsFile)
 	if err != nil {
 		return nil, err
@@ -41,6 +77,107 @@ func NewAuthClient(projectID, credentialsFile, apiKey string) (*AuthClient, erro
 	return f, nil
 }
 
+// NewEmulatorAuthClient returns an AuthClient for the Auth emulator running at host.
+// It accepts unsigned tokens, never use it in production.
+func NewEmulatorAuthClient(projectID, host, apiKey string) *AuthClient {
+	f := &AuthClient{ApiKey: apiKey, Ctx: context.Background(), ProjectID: projectID, EmulatorHost: host}
+	// a client without credentials whose requests all fail, so the *auth.Client calls return an error
+	app, err := firebase.NewApp(f.Ctx, &firebase.Config{
+		ProjectID:        projectID,
+		ServiceAccountID: "emulator@" + projectID + ".iam.gserviceaccount.com",
+	}, option.WithHTTPClient(&http.Client{Transport: unsupportedTransport{}}))
+	if err == nil {
+		f.Client, err = app.Auth(f.Ctx)
+	}
+	if err != nil {
+		panic("IGin: firebase emulator client: " + err.Error())
+	}
+	return f
+}
+
+type unsupportedTransport struct{}
+
+// RoundTrip answers with 501, transport errors would be retried by the sdk.
+func (unsupportedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, _ := json.Marshal(map[string]any{"error": map[string]any{"code": http.StatusNotImplemented, "message": ErrEmulatorUnsupported.Error()}})
+	return &http.Response{
+		StatusCode: http.StatusNotImplemented,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// VerifyIDToken verifies the signature and payload of idToken.
+func (f *AuthClient) VerifyIDToken(ctx context.Context, idToken string) (*auth.Token, error) {
+	if f.EmulatorHost != "" {
+		return f.verifyEmulatorToken(idToken, "https://securetoken.google.com/")
+	}
+	return f.Client.VerifyIDToken(ctx, idToken)
+}
+
+// VerifyIDTokenAndCheckRevoked verifies idToken and checks it was not revoked.
+// The emulator does not revoke tokens, the check is skipped for it.
+func (f *AuthClient) VerifyIDTokenAndCheckRevoked(ctx context.Context, idToken string) (*auth.Token, error) {
+	if f.EmulatorHost != "" {
+		return f.VerifyIDToken(ctx, idToken)
+	}
+	return f.Client.VerifyIDTokenAndCheckRevoked(ctx, idToken)
+}
+
+// VerifySessionCookie verifies the signature and payload of the session cookie.
+func (f *AuthClient) VerifySessionCookie(ctx context.Context, sessionCookie string) (*auth.Token, error) {
+	if f.EmulatorHost != "" {
+		return f.verifyEmulatorToken(sessionCookie, "https://session.firebase.google.com/")
+	}
+	return f.Client.VerifySessionCookie(ctx, sessionCookie)
+}
+
+// VerifySessionCookieAndCheckRevoked verifies the session cookie and checks it was not revoked.
+// The emulator does not revoke tokens, the check is skipped for it.
+func (f *AuthClient) VerifySessionCookieAndCheckRevoked(ctx context.Context, sessionCookie string) (*auth.Token, error) {
+	if f.EmulatorHost != "" {
+		return f.VerifySessionCookie(ctx, sessionCookie)
+	}
+	return f.Client.VerifySessionCookieAndCheckRevoked(ctx, sessionCookie)
+}
+
+// verifyEmulatorToken checks the payload of an unsigned emulator token.
+func (f *AuthClient) verifyEmulatorToken(token, issuerPrefix string) (*auth.Token, error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, errors.New("incorrect number of segments")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segments[1], "="))
+	if err != nil {
+		return nil, err
+	}
+	t := &auth.Token{}
+	if err := json.Unmarshal(payload, t); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(payload, &t.Claims); err != nil {
+		return nil, err
+	}
+	for _, standardClaim := range []string{"iss", "aud", "exp", "iat", "sub", "uid"} {
+		delete(t.Claims, standardClaim)
+	}
+	if t.Audience != f.ProjectID {
+		return nil, fmt.Errorf("token has invalid 'aud' (audience) claim; expected %q but got %q", f.ProjectID, t.Audience)
+	}
+	if t.Issuer != issuerPrefix+f.ProjectID {
+		return nil, fmt.Errorf("token has invalid 'iss' (issuer) claim; expected %q but got %q", issuerPrefix+f.ProjectID, t.Issuer)
+	}
+	if t.Subject == "" {
+		return nil, errors.New("token has empty 'sub' (subject) claim")
+	}
+	if t.Expires <= time.Now().Unix() {
+		return nil, errors.New("token has expired")
+	}
+	t.UID = t.Subject
+	return t, nil
+}
+
 type IDToken struct {
 	IDToken      string `json:"idToken"`
 	RefreshToken string `json:"refreshToken"`
@@ -56,9 +193,14 @@ func (f AuthClient) TokenToIDToken(token string) (IDToken, error) {
 	}{
 		token, true,
 	}
+	endpoint := "https://identitytoolkit.googleapis.com"
+	if f.EmulatorHost != "" {
+		endpoint = "http://" + f.EmulatorHost + "/identitytoolkit.googleapis.com"
+	}
 	resp, err := requests.PostJson(
 		fmt.Sprintf(
-			"https://identitytoolkit.googleapis.com/v1/accounts:signInWithCustomToken?key=%s",
+			"%s/v1/accounts:signInWithCustomToken?key=%s",
+			endpoint,
 			f.ApiKey,
 		),
 		data,
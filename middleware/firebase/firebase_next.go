@@ -1,10 +1,12 @@
 package firebase
 
 import (
+	"encoding/json"
 	"firebase.google.com/go/auth"
 	"fmt"
 	"github.com/pkg6/igin/xerror"
 	"net/http"
+	"reflect"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pkg6/igin"
@@ -46,6 +48,20 @@ type (
 		AuthScheme string
 		//NewAuthClient
 		AuthClient *AuthClient
+		// Verifier verifies the tokens. Takes precedence over AuthClient, useful to inject a fake verifier in tests.
+		// Optional. Default value AuthClient.
+		Verifier Verifier
+		// CheckRevoked uses VerifyIDTokenAndCheckRevoked / VerifySessionCookieAndCheckRevoked, which costs an
+		// extra request to firebase per verification.
+		// Optional. Default value false.
+		CheckRevoked bool
+		// RequiredClaims are custom claims the token must carry, e.g. map[string]any{"admin": true}.
+		// Values are compared as decoded json, so 1 matches the json number 1 but not the string "1".
+		// Optional.
+		RequiredClaims map[string]any
+		// SessionCookieName is the name of a firebase session cookie verified when no id token was found or valid.
+		// Optional. Default value "", session cookies are not used.
+		SessionCookieName string
 	}
 )
 
@@ -60,8 +76,9 @@ var (
 		TokenLookup:    middleware.ExtractorMethodHeader + ":" + igin.HeaderAuthorization,
 		AuthScheme:     "Bearer",
 	}
-	ErrMissing = xerror.NewHTTPError(http.StatusBadRequest, "missing or malformed firebase")
-	ErrInvalid = xerror.NewHTTPError(http.StatusUnauthorized, "invalid or expired firebase")
+	ErrMissing   = xerror.NewHTTPError(http.StatusBadRequest, "missing or malformed firebase")
+	ErrInvalid   = xerror.NewHTTPError(http.StatusUnauthorized, "invalid or expired firebase")
+	ErrForbidden = xerror.NewHTTPError(http.StatusForbidden, "missing required firebase claims")
 )
 
 func ContextToken(c *gin.Context) (*auth.Token, error) {
@@ -113,8 +130,14 @@ func NextWithConfig(config FirebaseConfig) gin.HandlerFunc {
 	if config.ErrorHandler == nil {
 		config.ErrorHandler = defaultConfig.ErrorHandler
 	}
-	if config.AuthClient == nil {
-		panic("IGin: firebase middleware requires *firebase.Firebase")
+	if config.Verifier == nil && config.AuthClient != nil {
+		config.Verifier = config.AuthClient
+	}
+	if config.Verifier == nil {
+		panic("IGin: firebase middleware requires *firebase.AuthClient or firebase.Verifier")
+	}
+	if config.ContextKey == "" {
+		config.ContextKey = defaultConfig.ContextKey
 	}
 	if config.TokenLookup == "" {
 		config.TokenLookup = defaultConfig.TokenLookup
@@ -140,20 +163,26 @@ func NextWithConfig(config FirebaseConfig) gin.HandlerFunc {
 				continue
 			}
 			for _, auth := range auths {
-				token, err := config.AuthClient.VerifyIDToken(config.AuthClient.Ctx, auth)
+				token, err := config.verifyIDToken(c, auth)
 				if err != nil {
 					lastTokenErr = err
 					continue
 				}
-				// Store user information from token into context.
-				c.Set(config.ContextKey, token)
-				if config.SuccessHandler != nil {
-					config.SuccessHandler(c)
-				}
-				c.Next()
+				config.success(c, token)
 				return
 			}
 		}
+		if config.SessionCookieName != "" {
+			if cookie, err := c.Cookie(config.SessionCookieName); err == nil && cookie != "" {
+				token, err := config.verifySessionCookie(c, cookie)
+				if err == nil {
+					config.success(c, token)
+					return
+				}
+				lastExtractorErr = nil
+				lastTokenErr = err
+			}
+		}
 		if lastExtractorErr != nil {
 			config.ErrorHandler(c, ErrMissing, ErrMissing.Code)
 			return
@@ -164,3 +193,48 @@ func NextWithConfig(config FirebaseConfig) gin.HandlerFunc {
 		}
 	}
 }
+
+func (config *FirebaseConfig) verifyIDToken(c *gin.Context, idToken string) (*auth.Token, error) {
+	if config.CheckRevoked {
+		return config.Verifier.VerifyIDTokenAndCheckRevoked(c.Request.Context(), idToken)
+	}
+	return config.Verifier.VerifyIDToken(c.Request.Context(), idToken)
+}
+
+func (config *FirebaseConfig) verifySessionCookie(c *gin.Context, sessionCookie string) (*auth.Token, error) {
+	if config.CheckRevoked {
+		return config.Verifier.VerifySessionCookieAndCheckRevoked(c.Request.Context(), sessionCookie)
+	}
+	return config.Verifier.VerifySessionCookie(c.Request.Context(), sessionCookie)
+}
+
+// success stores the token and continues, unless the token lacks RequiredClaims.
+func (config *FirebaseConfig) success(c *gin.Context, token *auth.Token) {
+	for claim, value := range config.RequiredClaims {
+		actual, ok := token.Claims[claim]
+		if !ok || !reflect.DeepEqual(jsonValue(actual), jsonValue(value)) {
+			config.ErrorHandler(c, ErrForbidden, ErrForbidden.Code)
+			return
+		}
+	}
+	// Store user information from token into context.
+	c.Set(config.ContextKey, token)
+	if config.SuccessHandler != nil {
+		config.SuccessHandler(c)
+	}
+	c.Next()
+}
+
+// jsonValue converts v to its JSON decoded form, numbers become float64 and structs maps,
+// so required claims compare by type and value as the decoded token claims.
+func jsonValue(v any) any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var decoded any
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return v
+	}
+	return decoded
+}
@@ -0,0 +1,105 @@
+package firebase
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeVerifier map[string]*auth.Token
+
+func (f fakeVerifier) verify(token string) (*auth.Token, error) {
+	if t, ok := f[token]; ok {
+		return t, nil
+	}
+	return nil, errors.New("invalid token")
+}
+
+func (f fakeVerifier) VerifyIDToken(ctx context.Context, idToken string) (*auth.Token, error) {
+	return f.verify(idToken)
+}
+
+func (f fakeVerifier) VerifyIDTokenAndCheckRevoked(ctx context.Context, idToken string) (*auth.Token, error) {
+	return f.verify(idToken)
+}
+
+func (f fakeVerifier) VerifySessionCookie(ctx context.Context, sessionCookie string) (*auth.Token, error) {
+	return f.verify(sessionCookie)
+}
+
+func (f fakeVerifier) VerifySessionCookieAndCheckRevoked(ctx context.Context, sessionCookie string) (*auth.Token, error) {
+	return f.verify(sessionCookie)
+}
+
+func TestNextWithConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.Use(NextWithConfig(FirebaseConfig{
+		Verifier: fakeVerifier{
+			"admin":  {UID: "1", Claims: map[string]interface{}{"admin": true, "level": float64(1)}},
+			"user":   {UID: "2", Claims: map[string]interface{}{}},
+			"string": {UID: "3", Claims: map[string]interface{}{"admin": "true", "level": "1"}},
+		},
+		RequiredClaims:    map[string]any{"admin": true, "level": 1},
+		SessionCookieName: "session",
+	}))
+	g.GET("/", func(c *gin.Context) {
+		token, _ := ContextToken(c)
+		c.String(http.StatusOK, token.UID)
+	})
+	cases := []struct {
+		header string
+		cookie string
+		status int
+	}{
+		{header: "Bearer admin", status: http.StatusOK},
+		{cookie: "admin", status: http.StatusOK},
+		{header: "Bearer user", status: http.StatusForbidden},
+		{header: "Bearer string", status: http.StatusForbidden},
+		{header: "Bearer other", status: http.StatusUnauthorized},
+		{status: http.StatusBadRequest},
+	}
+	for _, each := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if each.header != "" {
+			req.Header.Set("Authorization", each.header)
+		}
+		if each.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "session", Value: each.cookie})
+		}
+		g.ServeHTTP(w, req)
+		assert.Equal(t, each.status, w.Code, each)
+	}
+}
+
+func TestEmulatorVerifyIDToken(t *testing.T) {
+	client := NewEmulatorAuthClient("demo", "127.0.0.1:9099", "")
+	exp := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	payload := `{"iss":"https://securetoken.google.com/demo","aud":"demo","sub":"uid","exp":` + exp + `,"admin":true}`
+	token := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(payload)) + "."
+	decoded, err := client.VerifyIDToken(context.Background(), token)
+	assert.NoError(t, err)
+	assert.Equal(t, "uid", decoded.UID)
+	assert.Equal(t, true, decoded.Claims["admin"])
+
+	_, err = NewEmulatorAuthClient("other", "127.0.0.1:9099", "").VerifyIDToken(context.Background(), token)
+	assert.Error(t, err)
+
+	assert.NotPanics(t, func() {
+		_, err = client.GetUser(context.Background(), "uid")
+		assert.ErrorContains(t, err, ErrEmulatorUnsupported.Error())
+		_, err = client.CustomToken(context.Background(), "uid")
+		assert.Error(t, err)
+	}, "admin api calls fail instead of panicking")
+}
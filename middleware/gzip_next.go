@@ -4,6 +4,7 @@ import (
 	"compress/gzip"
 	"fmt"
 	"io"
+	"net/http"
 	"strings"
 	"sync"
 
@@ -55,7 +56,7 @@ func GzipNextWithConfig(config GzipConfig) gin.HandlerFunc {
 			strings.Contains(req.Header.Get(igin.HeaderAccept), igin.MIMEEventStream) {
 			return
 		}
-		c.Header(igin.HeaderVary, igin.HeaderAcceptEncoding)
+		AddVary(c, igin.HeaderAcceptEncoding)
 		c.Header(igin.HeaderContentEncoding, gzipScheme)
 		grw := &gzipWriter{writer: gz, ResponseWriter: c.Writer}
 		defer func() {
@@ -86,6 +87,11 @@ type gzipWriter struct {
 	writer *gzip.Writer
 }
 
+// Unwrap returns the wrapped ResponseWriter.
+func (g *gzipWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
 func (g *gzipWriter) WriteString(s string) (int, error) {
 	g.Header().Del(igin.HeaderContentLength)
 	return g.writer.Write([]byte(s))
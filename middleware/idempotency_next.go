@@ -0,0 +1,330 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/pkg6/igin/xerror"
+)
+
+type (
+	// IdempotencyConfig defines the config for Idempotency middleware.
+	IdempotencyConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+		// ErrorHandler defines a function which is executed for rejected requests.
+		ErrorHandler ErrorHandler
+		// KeyLookup is a string in the form of "<source>:<name>" or "<source>:<name>,<source>:<name>" that is used
+		// to extract the idempotency key from the request.
+		// Optional. Default value "header:Idempotency-Key".
+		KeyLookup string
+		// Methods the middleware applies to, other requests pass through.
+		// Optional. Default value []string{"POST", "PATCH"}.
+		Methods []string
+		// Required rejects requests without key with ErrIdempotencyKeyMissing.
+		// Optional. Default value false, requests without key pass through.
+		Required bool
+		// Store keeps the responses.
+		// Optional. Default value is an in-memory store.
+		Store IdempotencyStore
+		// TTL is how long responses are replayed.
+		// Optional. Default value 24 hours.
+		TTL time.Duration
+		// Scope returns a prefix keys are scoped by, e.g. the user id, so clients can not replay responses of others.
+		// Optional. Default value is the Principal of AuthChain, or else the Authorization header, the middleware
+		// must then be used after the authentication. Requests without either share the keys.
+		Scope func(c *gin.Context) string
+		// Fingerprint identifies the request a key was first used with.
+		// Optional. Default value is the sha256 of method, path, query and body.
+		Fingerprint func(c *gin.Context, body []byte) string
+		// MaxBodySize limits the body read for the fingerprint.
+		// Optional. Default value 10MB.
+		MaxBodySize int64
+	}
+
+	// IdempotencyRecord is the state of a key, Done is false while the first request is in flight.
+	IdempotencyRecord struct {
+		Fingerprint string
+		Done        bool
+		Status      int
+		Header      http.Header
+		Body        []byte
+	}
+
+	// IdempotencyStore keeps idempotency records.
+	IdempotencyStore interface {
+		// Begin records an in-flight request for key when there is no record yet and returns true,
+		// otherwise it returns the existing record.
+		Begin(key string, record *IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, bool, error)
+		// Complete replaces the record of key with the finished response.
+		Complete(key string, record *IdempotencyRecord, ttl time.Duration) error
+		// Release removes the record of key so the request can be retried.
+		Release(key string) error
+	}
+
+	idempotencyWriter struct {
+		gin.ResponseWriter
+		body bytes.Buffer
+	}
+)
+
+var (
+	// DefaultIdempotencyConfig is the default Idempotency middleware config.
+	defaultIdempotencyConfig = IdempotencyConfig{
+		Skipper:      DefaultSkipper,
+		ErrorHandler: DefaultErrorHandler,
+		KeyLookup:    ExtractorMethodHeader + ":" + igin.HeaderIdempotencyKey,
+		Methods:      []string{http.MethodPost, http.MethodPatch},
+		TTL:          24 * time.Hour,
+		MaxBodySize:  10 << 20,
+	}
+	ErrIdempotencyKeyMissing = xerror.NewHTTPError(http.StatusBadRequest, "missing idempotency key")
+	ErrIdempotencyInFlight   = xerror.NewHTTPError(http.StatusConflict, "a request with the same idempotency key is in progress")
+	ErrIdempotencyMismatch   = xerror.NewHTTPError(http.StatusUnprocessableEntity, "idempotency key reused with a different request")
+	ErrIdempotencyBodySize   = xerror.NewHTTPError(http.StatusRequestEntityTooLarge, "request body too large")
+)
+
+// IdempotencyNext returns an Idempotency middleware.
+func IdempotencyNext() gin.HandlerFunc {
+	return IdempotencyNextWithConfig(defaultIdempotencyConfig)
+}
+
+// IdempotencyNextWithConfig returns an Idempotency middleware with config.
+//
+// The first response of a key is stored and replayed for repeats with the `Idempotent-Replayed: true` header.
+// Repeats while the first request is in flight get ErrIdempotencyInFlight, repeats with another request
+// fingerprint get ErrIdempotencyMismatch. Server errors (5xx) and the retryable client errors 401, 403, 408, 409
+// and 429 are not stored so the request can be retried. Set-Cookie headers are not replayed.
+func IdempotencyNextWithConfig(config IdempotencyConfig) gin.HandlerFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = defaultIdempotencyConfig.Skipper
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = defaultIdempotencyConfig.ErrorHandler
+	}
+	if config.KeyLookup == "" {
+		config.KeyLookup = defaultIdempotencyConfig.KeyLookup
+	}
+	if len(config.Methods) == 0 {
+		config.Methods = defaultIdempotencyConfig.Methods
+	}
+	if config.Store == nil {
+		config.Store = NewMemoryIdempotencyStore()
+	}
+	if config.TTL == 0 {
+		config.TTL = defaultIdempotencyConfig.TTL
+	}
+	if config.Scope == nil {
+		config.Scope = idempotencyScope
+	}
+	if config.Fingerprint == nil {
+		config.Fingerprint = idempotencyFingerprint
+	}
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = defaultIdempotencyConfig.MaxBodySize
+	}
+	extractors, cErr := CreateExtractors(config.KeyLookup, "")
+	if cErr != nil {
+		panic(cErr)
+	}
+	methods := make(map[string]bool, len(config.Methods))
+	for _, method := range config.Methods {
+		methods[method] = true
+	}
+	return func(c *gin.Context) {
+		if config.Skipper(c) || !methods[c.Request.Method] {
+			c.Next()
+			return
+		}
+		key := ""
+		for _, extractor := range extractors {
+			if keys, err := extractor(c); err == nil && len(keys) > 0 && keys[0] != "" {
+				key = keys[0]
+				break
+			}
+		}
+		if key == "" {
+			if config.Required {
+				config.ErrorHandler(c, ErrIdempotencyKeyMissing, ErrIdempotencyKeyMissing.Code)
+				return
+			}
+			c.Next()
+			return
+		}
+		key = config.Scope(c) + ":" + key
+		body, err := readRequestBody(c, config.MaxBodySize)
+		if err != nil {
+			config.ErrorHandler(c, ErrIdempotencyBodySize, ErrIdempotencyBodySize.Code)
+			return
+		}
+		fingerprint := config.Fingerprint(c, body)
+		record, begun, err := config.Store.Begin(key, &IdempotencyRecord{Fingerprint: fingerprint}, config.TTL)
+		if err != nil {
+			config.ErrorHandler(c, err, http.StatusInternalServerError)
+			return
+		}
+		if !begun {
+			switch {
+			case record.Fingerprint != fingerprint:
+				config.ErrorHandler(c, ErrIdempotencyMismatch, ErrIdempotencyMismatch.Code)
+			case !record.Done:
+				config.ErrorHandler(c, ErrIdempotencyInFlight, ErrIdempotencyInFlight.Code)
+			default:
+				replayIdempotencyRecord(c, record)
+			}
+			return
+		}
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		completed := false
+		defer func() {
+			c.Writer = writer.ResponseWriter
+			if !completed {
+				// the handler panicked
+				_ = config.Store.Release(key)
+			}
+		}()
+		c.Next()
+		completed = true
+		status := writer.Status()
+		if retryableStatus(status) {
+			if err := config.Store.Release(key); err != nil {
+				_ = c.Error(err)
+			}
+			return
+		}
+		header := writer.Header().Clone()
+		header.Del(igin.HeaderSetCookie)
+		done := &IdempotencyRecord{
+			Fingerprint: fingerprint,
+			Done:        true,
+			Status:      status,
+			Header:      header,
+			Body:        writer.body.Bytes(),
+		}
+		if err := config.Store.Complete(key, done, config.TTL); err != nil {
+			_ = c.Error(err)
+		}
+	}
+}
+
+func replayIdempotencyRecord(c *gin.Context, record *IdempotencyRecord) {
+	header := c.Writer.Header()
+	for name, values := range record.Header {
+		header[name] = values
+	}
+	header.Set(igin.HeaderIdempotentReplayed, "true")
+	c.Status(record.Status)
+	_, _ = c.Writer.Write(record.Body)
+	c.Abort()
+}
+
+// retryableStatus reports whether a response with status may succeed when retried and must not be replayed.
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusConflict,
+		http.StatusTooManyRequests:
+		return true
+	}
+	return status >= http.StatusInternalServerError
+}
+
+// idempotencyScope scopes keys by the caller, the Principal of AuthChain or else the Authorization header.
+func idempotencyScope(c *gin.Context) string {
+	identity := c.Request.Header.Get(igin.HeaderAuthorization)
+	if principal, err := ContextPrincipal(c); err == nil {
+		switch value := principal.Value.(type) {
+		case string:
+			identity = principal.Scheme + ":" + value
+		case *APIKey:
+			identity = principal.Scheme + ":" + value.Prefix
+		}
+	}
+	if identity == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(identity))
+	return hex.EncodeToString(sum[:])
+}
+
+func idempotencyFingerprint(c *gin.Context, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(c.Request.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(c.Request.URL.RequestURI()))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (w *idempotencyWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Unwrap returns the wrapped ResponseWriter.
+func (w *idempotencyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+type idempotencyEntry struct {
+	record  *IdempotencyRecord
+	expires time.Time
+}
+
+// MemoryIdempotencyStore is an in-memory IdempotencyStore.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]idempotencyEntry
+	sweep   time.Time
+}
+
+// NewMemoryIdempotencyStore returns an empty MemoryIdempotencyStore.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{entries: make(map[string]idempotencyEntry)}
+}
+
+func (s *MemoryIdempotencyStore) Begin(key string, record *IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.After(s.sweep) {
+		for k, entry := range s.entries {
+			if now.After(entry.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.sweep = now.Add(time.Minute)
+	}
+	if entry, ok := s.entries[key]; ok && now.Before(entry.expires) {
+		return entry.record, false, nil
+	}
+	s.entries[key] = idempotencyEntry{record: record, expires: now.Add(ttl)}
+	return record, true, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(key string, record *IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = idempotencyEntry{record: record, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
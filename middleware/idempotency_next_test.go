@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyNext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	calls := 0
+	started, release := make(chan struct{}), make(chan struct{})
+	g := gin.New()
+	g.Use(IdempotencyNext())
+	g.POST("/pay", func(c *gin.Context) {
+		calls++
+		c.Header("X-Payment", "p1")
+		c.SetCookie("session", "s1", 0, "/", "", false, true)
+		c.String(http.StatusCreated, "paid %d", calls)
+	})
+	g.POST("/slow", func(c *gin.Context) {
+		close(started)
+		<-release
+	})
+	g.POST("/fail", func(c *gin.Context) {
+		calls++
+		c.Status(http.StatusBadGateway)
+	})
+	g.POST("/limited", func(c *gin.Context) {
+		calls++
+		c.Status(http.StatusTooManyRequests)
+	})
+
+	authorization := ""
+	post := func(path, key, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(igin.HeaderIdempotencyKey, key)
+		}
+		if authorization != "" {
+			req.Header.Set(igin.HeaderAuthorization, authorization)
+		}
+		g.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/pay", "k1", "amount=1")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "paid 1", w.Body.String())
+	w = post("/pay", "k1", "amount=1")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "paid 1", w.Body.String())
+	assert.Equal(t, "p1", w.Header().Get("X-Payment"))
+	assert.Equal(t, "true", w.Header().Get(igin.HeaderIdempotentReplayed))
+	assert.Empty(t, w.Header().Get(igin.HeaderSetCookie), "cookies are not replayed")
+	assert.Equal(t, 1, calls)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, post("/pay", "k1", "amount=2").Code)
+	assert.Equal(t, "paid 2", post("/pay", "", "amount=1").Body.String(), "requests without key pass through")
+
+	done := make(chan struct{})
+	go func() {
+		post("/slow", "k2", "")
+		close(done)
+	}()
+	<-started
+	assert.Equal(t, http.StatusConflict, post("/slow", "k2", "").Code)
+	close(release)
+	<-done
+
+	calls = 0
+	post("/fail", "k3", "")
+	post("/fail", "k3", "")
+	assert.Equal(t, 2, calls, "server errors are not stored")
+	post("/limited", "k4", "")
+	post("/limited", "k4", "")
+	assert.Equal(t, 4, calls, "retryable client errors are not stored")
+
+	calls = 0
+	authorization = "Bearer alice"
+	post("/pay", "k5", "amount=1")
+	authorization = "Bearer mallory"
+	w = post("/pay", "k5", "amount=1")
+	assert.Equal(t, "paid 2", w.Body.String(), "keys are scoped by the Authorization header")
+	assert.Empty(t, w.Header().Get(igin.HeaderIdempotentReplayed))
+}
+
+func TestIdempotencyScopePrincipal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	calls := 0
+	g := gin.New()
+	g.Use(func(c *gin.Context) {
+		c.Set(PrincipalContextKey, &Principal{Scheme: AuthSchemeBasic, Value: c.Query("user")})
+	})
+	g.Use(IdempotencyNext())
+	g.POST("/pay", func(c *gin.Context) {
+		calls++
+		c.String(http.StatusCreated, "paid %d", calls)
+	})
+	post := func(user string) string {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/pay?user="+user, nil)
+		req.Header.Set(igin.HeaderIdempotencyKey, "k1")
+		g.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	assert.Equal(t, "paid 1", post("alice"))
+	assert.Equal(t, "paid 1", post("alice"))
+	assert.Equal(t, "paid 2", post("bob"), "keys are scoped by the principal")
+}
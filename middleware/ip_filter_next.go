@@ -0,0 +1,252 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/pkg6/igin/xerror"
+)
+
+type (
+	// IPFilterConfig defines the config for IPFilter middleware.
+	IPFilterConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+		// ErrorHandler defines a function which is executed for denied clients.
+		ErrorHandler ErrorHandler
+		// Allow are the CIDRs or ips allowed, all other clients are denied.
+		// Optional. Default value none, all clients not denied are allowed.
+		Allow []string
+		// Deny are the CIDRs or ips denied, deny rules take precedence over allow rules.
+		// Optional.
+		Deny []string
+		// File contains additional rules, one "allow <cidr>" or "deny <cidr>" per line, "#" starts a comment.
+		// It is reloaded when modified, invalid files are reported with c.Error and the previous rules are kept.
+		// Optional.
+		File string
+		// ReloadInterval is the minimum interval between checks of File for modifications.
+		// Optional. Default value 10 seconds.
+		ReloadInterval time.Duration
+		// TrustedProxies are the CIDRs of the proxies allowed to set X-Forwarded-For and X-Real-Ip.
+		// The client ip is the rightmost X-Forwarded-For entry which is not a trusted proxy.
+		// Optional. Default value none, c.ClientIP() is used which honors the trusted proxies of the gin engine.
+		TrustedProxies []string
+	}
+
+	// IPFilter holds the rules of an IPFilter middleware.
+	IPFilter struct {
+		config   IPFilterConfig
+		static   ipRules
+		rules    atomic.Value // ipRules
+		trusted  []*net.IPNet
+		mu       sync.Mutex
+		checked  time.Time
+		modified time.Time
+	}
+
+	ipRules struct {
+		allow []*net.IPNet
+		deny  []*net.IPNet
+	}
+)
+
+var (
+	// DefaultIPFilterConfig is the default IPFilter middleware config.
+	defaultIPFilterConfig = IPFilterConfig{
+		Skipper:        DefaultSkipper,
+		ErrorHandler:   DefaultErrorHandler,
+		ReloadInterval: 10 * time.Second,
+	}
+	ErrIPForbidden = xerror.NewHTTPError(http.StatusForbidden, "ip address not allowed")
+)
+
+// IPFilterNext returns an IPFilter middleware allowing the given CIDRs only.
+func IPFilterNext(allow ...string) gin.HandlerFunc {
+	c := defaultIPFilterConfig
+	c.Allow = allow
+	return IPFilterNextWithConfig(c)
+}
+
+// IPFilterNextWithConfig returns an IPFilter middleware with config.
+func IPFilterNextWithConfig(config IPFilterConfig) gin.HandlerFunc {
+	filter, err := NewIPFilter(config)
+	if err != nil {
+		panic(err)
+	}
+	return filter.Next()
+}
+
+// NewIPFilter parses the rules of config and loads File.
+func NewIPFilter(config IPFilterConfig) (*IPFilter, error) {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = defaultIPFilterConfig.Skipper
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = defaultIPFilterConfig.ErrorHandler
+	}
+	if config.ReloadInterval == 0 {
+		config.ReloadInterval = defaultIPFilterConfig.ReloadInterval
+	}
+	f := &IPFilter{config: config}
+	var err error
+	if f.static.allow, err = ParseCIDRs(config.Allow); err != nil {
+		return nil, err
+	}
+	if f.static.deny, err = ParseCIDRs(config.Deny); err != nil {
+		return nil, err
+	}
+	if f.trusted, err = ParseCIDRs(config.TrustedProxies); err != nil {
+		return nil, err
+	}
+	f.rules.Store(f.static)
+	if config.File != "" {
+		if err := f.Reload(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Next returns the middleware denying clients with ErrIPForbidden.
+func (f *IPFilter) Next() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if f.config.Skipper(c) {
+			c.Next()
+			return
+		}
+		if f.config.File != "" {
+			if err := f.reloadIfModified(); err != nil {
+				_ = c.Error(err)
+			}
+		}
+		if !f.Allowed(net.ParseIP(f.ClientIP(c))) {
+			f.config.ErrorHandler(c, ErrIPForbidden, ErrIPForbidden.Code)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Allowed reports whether ip passes the rules, invalid ips are denied.
+func (f *IPFilter) Allowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	rules := f.rules.Load().(ipRules)
+	if containsIP(rules.deny, ip) {
+		return false
+	}
+	return len(rules.allow) == 0 || containsIP(rules.allow, ip)
+}
+
+// ClientIP resolves the client ip of the request, see IPFilterConfig.TrustedProxies.
+func (f *IPFilter) ClientIP(c *gin.Context) string {
+	if len(f.trusted) == 0 {
+		return c.ClientIP()
+	}
+	remoteIP := c.RemoteIP()
+	if !containsIP(f.trusted, net.ParseIP(remoteIP)) {
+		return remoteIP
+	}
+	if forwarded := c.Request.Header.Get(igin.HeaderXForwardedFor); forwarded != "" {
+		items := strings.Split(forwarded, ",")
+		for i := len(items) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(items[i]))
+			if ip == nil {
+				break
+			}
+			if i == 0 || !containsIP(f.trusted, ip) {
+				return ip.String()
+			}
+		}
+	}
+	if realIP := net.ParseIP(strings.TrimSpace(c.Request.Header.Get(igin.HeaderXRealIP))); realIP != nil {
+		return realIP.String()
+	}
+	return remoteIP
+}
+
+// Reload loads the rules of File.
+func (f *IPFilter) Reload() error {
+	info, err := os.Stat(f.config.File)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(f.config.File)
+	if err != nil {
+		return err
+	}
+	rules, err := parseIPRules(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.config.File, err)
+	}
+	rules.allow = append(append([]*net.IPNet{}, f.static.allow...), rules.allow...)
+	rules.deny = append(append([]*net.IPNet{}, f.static.deny...), rules.deny...)
+	f.rules.Store(rules)
+	f.mu.Lock()
+	f.modified = info.ModTime()
+	f.checked = time.Now()
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *IPFilter) reloadIfModified() error {
+	f.mu.Lock()
+	if time.Since(f.checked) < f.config.ReloadInterval {
+		f.mu.Unlock()
+		return nil
+	}
+	f.checked = time.Now()
+	modified := f.modified
+	f.mu.Unlock()
+	info, err := os.Stat(f.config.File)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(modified) {
+		return nil
+	}
+	return f.Reload()
+}
+
+func parseIPRules(data []byte) (ipRules, error) {
+	var rules ipRules
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return rules, fmt.Errorf("line %d: expected \"allow <cidr>\" or \"deny <cidr>\"", line)
+		}
+		nets, err := ParseCIDRs(fields[1:])
+		if err != nil {
+			return rules, fmt.Errorf("line %d: %w", line, err)
+		}
+		switch strings.ToLower(fields[0]) {
+		case "allow":
+			rules.allow = append(rules.allow, nets...)
+		case "deny":
+			rules.deny = append(rules.deny, nets...)
+		default:
+			return rules, fmt.Errorf("line %d: unknown action %q", line, fields[0])
+		}
+	}
+	return rules, scanner.Err()
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPFilterNextWithConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	file := filepath.Join(t.TempDir(), "ips")
+	assert.NoError(t, os.WriteFile(file, []byte("# office\nallow 2001:db8::/32\n"), 0600))
+	g := gin.New()
+	g.Use(IPFilterNextWithConfig(IPFilterConfig{
+		Allow:          []string{"10.0.0.0/8"},
+		Deny:           []string{"10.0.0.66"},
+		File:           file,
+		ReloadInterval: time.Nanosecond,
+		TrustedProxies: []string{"192.0.2.1"},
+	}))
+	g.GET("/", func(c *gin.Context) {})
+
+	status := func(remoteAddr, forwardedFor string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set(igin.HeaderXForwardedFor, forwardedFor)
+		}
+		g.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, status("10.1.2.3:1234", ""))
+	assert.Equal(t, http.StatusForbidden, status("10.0.0.66:1234", ""))
+	assert.Equal(t, http.StatusForbidden, status("203.0.113.1:1234", ""))
+	assert.Equal(t, http.StatusOK, status("[2001:db8::1]:1234", ""))
+	assert.Equal(t, http.StatusOK, status("192.0.2.1:1234", "203.0.113.1, 10.1.2.3"))
+	assert.Equal(t, http.StatusForbidden, status("192.0.2.1:1234", "10.1.2.3, 203.0.113.1"))
+	assert.Equal(t, http.StatusForbidden, status("203.0.113.1:1234", "10.1.2.3"), "untrusted proxies are ignored")
+
+	assert.NoError(t, os.WriteFile(file, []byte("allow 203.0.113.0/24\n"), 0600))
+	assert.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Minute)))
+	assert.Equal(t, http.StatusOK, status("203.0.113.1:1234", ""))
+	assert.Equal(t, http.StatusForbidden, status("[2001:db8::1]:1234", ""))
+
+	_, err := NewIPFilter(IPFilterConfig{Allow: []string{"nope"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,306 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg6/igin"
+	"github.com/pkg6/igin/xerror"
+)
+
+// Error codes of the JSON-RPC 2.0 specification.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+const version = "2.0"
+
+type (
+	// Config defines the config for the JSON-RPC plugin.
+	Config struct {
+		// Path the plugin is registered under.
+		// Optional. Default value "/rpc".
+		Path string
+		// MaxBatch is the maximum number of calls in a batch.
+		// Optional. Default value 100.
+		MaxBatch int
+		// MaxBodySize is the maximum size of a request body.
+		// Optional. Default value 1MB.
+		MaxBodySize int64
+	}
+
+	// Server is an igin.IPlugin serving JSON-RPC 2.0 calls over HTTP POST.
+	Server struct {
+		config  Config
+		mu      sync.RWMutex
+		methods map[string]HandlerFunc
+	}
+
+	// HandlerFunc handles the calls of a method, params is the raw "params" member, nil when absent.
+	HandlerFunc func(c *gin.Context, params json.RawMessage) (any, error)
+
+	// Error is a JSON-RPC error object, return it from a handler to control the code.
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    any    `json:"data,omitempty"`
+	}
+
+	request struct {
+		JSONRPC string          `json:"jsonrpc"`
+		Method  string          `json:"method"`
+		Params  json.RawMessage `json:"params,omitempty"`
+		// ID is nil when absent and "null" when null
+		ID json.RawMessage `json:"id"`
+	}
+
+	response struct {
+		JSONRPC string          `json:"jsonrpc"`
+		Result  json.RawMessage `json:"result,omitempty"`
+		Error   *Error          `json:"error,omitempty"`
+		ID      json.RawMessage `json:"id"`
+	}
+)
+
+var (
+	// DefaultConfig is the default JSON-RPC config.
+	defaultConfig = Config{
+		Path:        "/rpc",
+		MaxBatch:    100,
+		MaxBodySize: 1 << 20,
+	}
+	nullID = json.RawMessage("null")
+)
+
+var _ igin.IPlugin = (*Server)(nil)
+
+// NewError returns an Error with code and message.
+func NewError(code int, message string, data ...any) *Error {
+	e := &Error{Code: code, Message: message}
+	if len(data) > 0 {
+		e.Data = data[0]
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// New returns the JSON-RPC plugin, register methods with Handle or HandleFunc.
+func New(config Config) *Server {
+	if config.Path == "" {
+		config.Path = defaultConfig.Path
+	}
+	if config.MaxBatch == 0 {
+		config.MaxBatch = defaultConfig.MaxBatch
+	}
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = defaultConfig.MaxBodySize
+	}
+	return &Server{config: config, methods: map[string]HandlerFunc{}}
+}
+
+// RouterPath igin.IPlugin
+func (s *Server) RouterPath() string {
+	return s.config.Path
+}
+
+// Register igin.IPlugin registers the POST route of the endpoint.
+func (s *Server) Register(group *gin.RouterGroup) {
+	group.POST("", s.Handler())
+}
+
+// HandleFunc registers handler for method.
+func (s *Server) HandleFunc(method string, handler HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.methods[method] = handler
+}
+
+// Methods returns the names of the registered methods.
+func (s *Server) Methods() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	methods := make([]string, 0, len(s.methods))
+	for method := range s.methods {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Handle registers handler for method. The params are decoded into P and validated with binding.Validator,
+// failures are reported as invalid params with the messages translated by igin.Translator.
+//
+//	jsonrpc.Handle(rpc, "user.get", func(c *gin.Context, p GetUserParams) (*User, error) {
+//		return users.Find(p.ID)
+//	})
+func Handle[P any, R any](s *Server, method string, handler func(c *gin.Context, params P) (R, error)) {
+	s.HandleFunc(method, func(c *gin.Context, raw json.RawMessage) (any, error) {
+		var params P
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &params); err != nil {
+				return nil, NewError(CodeInvalidParams, "Invalid params", err.Error())
+			}
+		}
+		if binding.Validator != nil {
+			if err := binding.Validator.ValidateStruct(params); err != nil {
+				return nil, err
+			}
+		}
+		return handler(c, params)
+	})
+}
+
+// Handler returns the handler serving single and batch calls. Notifications, calls without id, get no
+// response, a request of notifications only is answered with 204.
+func (s *Server) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, s.config.MaxBodySize+1))
+		if err != nil {
+			c.JSON(http.StatusOK, errorResponse(nullID, NewError(CodeParseError, "Parse error")))
+			return
+		}
+		if int64(len(body)) > s.config.MaxBodySize {
+			c.JSON(http.StatusOK, errorResponse(nullID, NewError(CodeInvalidRequest, "Request too large")))
+			return
+		}
+		body = bytes.TrimSpace(body)
+		if len(body) > 0 && body[0] == '[' {
+			var batch []json.RawMessage
+			if err = json.Unmarshal(body, &batch); err != nil {
+				c.JSON(http.StatusOK, errorResponse(nullID, NewError(CodeParseError, "Parse error")))
+				return
+			}
+			if len(batch) == 0 || len(batch) > s.config.MaxBatch {
+				c.JSON(http.StatusOK, errorResponse(nullID, NewError(CodeInvalidRequest, "Invalid Request")))
+				return
+			}
+			responses := make([]*response, 0, len(batch))
+			for _, raw := range batch {
+				if resp := s.call(c, raw); resp != nil {
+					responses = append(responses, resp)
+				}
+			}
+			if len(responses) == 0 {
+				c.Status(http.StatusNoContent)
+				return
+			}
+			c.JSON(http.StatusOK, responses)
+			return
+		}
+		if !json.Valid(body) {
+			c.JSON(http.StatusOK, errorResponse(nullID, NewError(CodeParseError, "Parse error")))
+			return
+		}
+		if resp := s.call(c, body); resp != nil {
+			c.JSON(http.StatusOK, resp)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// call runs a single call, it returns nil for notifications.
+func (s *Server) call(c *gin.Context, raw json.RawMessage) (resp *response) {
+	var req request
+	if err := json.Unmarshal(raw, &req); err != nil || req.JSONRPC != version || req.Method == "" || !validID(req.ID) {
+		return errorResponse(nullID, NewError(CodeInvalidRequest, "Invalid Request"))
+	}
+	notification := req.ID == nil
+	id := req.ID
+	if notification {
+		id = nullID
+	}
+	s.mu.RLock()
+	handler, ok := s.methods[req.Method]
+	s.mu.RUnlock()
+	if !ok {
+		if notification {
+			return nil
+		}
+		return errorResponse(id, NewError(CodeMethodNotFound, "Method not found"))
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			_ = c.Error(fmt.Errorf("jsonrpc: method %s panicked: %v", req.Method, r))
+			resp = errorResponse(id, NewError(CodeInternalError, "Internal error"))
+			if notification {
+				resp = nil
+			}
+		}
+	}()
+	result, err := handler(c, req.Params)
+	if notification {
+		return nil
+	}
+	if err != nil {
+		return errorResponse(id, toError(c, err))
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(id, NewError(CodeInternalError, "Internal error"))
+	}
+	return &response{JSONRPC: version, Result: b, ID: id}
+}
+
+// toError maps handler errors to JSON-RPC errors: *Error is kept, xerror.CodeMsg keeps its code and message,
+// validation errors become invalid params with the translated messages as data. Other errors are recorded with
+// c.Error and reported as internal error without their message, which may leak internal details.
+func toError(c *gin.Context, err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	var codeMsg *xerror.CodeMsg
+	if errors.As(err, &codeMsg) {
+		return NewError(codeMsg.Code, codeMsg.Msg)
+	}
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		if igin.Translator != nil {
+			err = igin.Translator.ValidateError(validationErrors)
+		}
+		if _, ok := err.(igin.ValidateErrors); !ok {
+			// no translator configured
+			errs := make(igin.ValidateErrors, 0, len(validationErrors))
+			for _, fieldError := range validationErrors {
+				errs = append(errs, &igin.ValidateError{Key: fieldError.Namespace(), Message: fieldError.Error()})
+			}
+			err = errs
+		}
+	}
+	var validateErrors igin.ValidateErrors
+	if errors.As(err, &validateErrors) {
+		return NewError(CodeInvalidParams, "Invalid params", validateErrors)
+	}
+	_ = c.Error(err)
+	return NewError(CodeInternalError, "Internal error")
+}
+
+// validID reports whether id is absent, a string, a number or null.
+func validID(id json.RawMessage) bool {
+	if id == nil {
+		return true
+	}
+	raw := bytes.TrimSpace(id)
+	return len(raw) > 0 && (raw[0] == '"' || raw[0] == '-' || (raw[0] >= '0' && raw[0] <= '9') || string(raw) == "null")
+}
+
+func errorResponse(id json.RawMessage, err *Error) *response {
+	return &response{JSONRPC: version, Error: err, ID: id}
+}
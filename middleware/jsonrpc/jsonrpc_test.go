@@ -0,0 +1,95 @@
+package jsonrpc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/pkg6/igin/xerror"
+	"github.com/stretchr/testify/assert"
+)
+
+type sumParams struct {
+	A int `json:"a" binding:"required"`
+	B int `json:"b"`
+}
+
+func TestServer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rpc := New(Config{})
+	Handle(rpc, "sum", func(c *gin.Context, p sumParams) (int, error) {
+		return p.A + p.B, nil
+	})
+	Handle(rpc, "echo", func(c *gin.Context, p []string) ([]string, error) {
+		return p, nil
+	})
+	notified := 0
+	Handle(rpc, "notify", func(c *gin.Context, p any) (any, error) {
+		notified++
+		return nil, nil
+	})
+	Handle(rpc, "fail", func(c *gin.Context, p any) (any, error) {
+		return nil, xerror.NewCodeMsg(1001, "insufficient funds")
+	})
+	Handle(rpc, "broken", func(c *gin.Context, p any) (any, error) {
+		return nil, errors.New("boom")
+	})
+	Handle(rpc, "panic", func(c *gin.Context, p any) (any, error) {
+		panic("crash")
+	})
+	e := igin.New()
+	var recorded []string
+	e.Use(func(c *gin.Context) {
+		c.Next()
+		recorded = append(recorded, c.Errors.Errors()...)
+	})
+	e.Plugin(rpc)
+
+	call := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body)))
+		return w
+	}
+
+	assert.JSONEq(t, `{"jsonrpc":"2.0","result":3,"id":1}`, call(`{"jsonrpc":"2.0","method":"sum","params":{"a":1,"b":2},"id":1}`).Body.String())
+	assert.JSONEq(t, `{"jsonrpc":"2.0","result":["x","y"],"id":"a"}`, call(`{"jsonrpc":"2.0","method":"echo","params":["x","y"],"id":"a"}`).Body.String())
+	assert.JSONEq(t, `{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":2}`, call(`{"jsonrpc":"2.0","method":"nope","id":2}`).Body.String())
+	assert.JSONEq(t, `{"jsonrpc":"2.0","error":{"code":1001,"message":"insufficient funds"},"id":3}`, call(`{"jsonrpc":"2.0","method":"fail","id":3}`).Body.String())
+	assert.JSONEq(t, `{"jsonrpc":"2.0","error":{"code":-32603,"message":"Internal error"},"id":4}`, call(`{"jsonrpc":"2.0","method":"broken","id":4}`).Body.String(),
+		"plain errors are not exposed")
+	assert.Contains(t, recorded, "boom", "but recorded on the context")
+	assert.JSONEq(t, `{"jsonrpc":"2.0","error":{"code":-32603,"message":"Internal error"},"id":null}`, call(`{"jsonrpc":"2.0","method":"panic","id":null}`).Body.String(),
+		"null ids are answered")
+	assert.Contains(t, recorded, "jsonrpc: method panic panicked: crash", "panics are recorded on the context")
+	assert.JSONEq(t, `{"jsonrpc":"2.0","result":3,"id":null}`, call(`{"jsonrpc":"2.0","method":"sum","params":{"a":3},"id":null}`).Body.String())
+	assert.JSONEq(t, `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`, call(`{"jsonrpc":"2.0","method":"sum","id":{}}`).Body.String())
+	assert.JSONEq(t, `{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}`, call(`{"jsonrpc":`).Body.String())
+	assert.JSONEq(t, `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`, call(`[]`).Body.String())
+
+	w := call(`{"jsonrpc":"2.0","method":"sum","params":{"b":2},"id":5}`)
+	assert.Contains(t, w.Body.String(), `"code":-32602`)
+	assert.Contains(t, w.Body.String(), `"key":"sumParams.A"`, "validation errors are listed as data")
+	assert.Contains(t, call(`{"jsonrpc":"2.0","method":"sum","params":[1,2],"id":6}`).Body.String(), `"code":-32602`)
+
+	w = call(`{"jsonrpc":"2.0","method":"notify"}`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, 1, notified)
+
+	w = call(`[
+		{"jsonrpc":"2.0","method":"sum","params":{"a":1},"id":1},
+		{"jsonrpc":"2.0","method":"notify"},
+		{"jsonrpc":"1.0","method":"sum","id":2},
+		{"jsonrpc":"2.0","method":"sum","params":{"a":5,"b":5},"id":3}
+	]`)
+	assert.JSONEq(t, `[
+		{"jsonrpc":"2.0","result":1,"id":1},
+		{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null},
+		{"jsonrpc":"2.0","result":10,"id":3}
+	]`, w.Body.String())
+	assert.Equal(t, 2, notified)
+	assert.Equal(t, []string{"broken", "echo", "fail", "notify", "panic", "sum"}, rpc.Methods())
+}
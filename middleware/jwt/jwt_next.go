@@ -84,6 +84,8 @@ type (
 	}
 )
 
+const AuthScheme = "jwt"
+
 var (
 	ContextKey = "user"
 	// DefaultJWTConfig is the default JWT auth middleware config.
@@ -165,10 +167,58 @@ func NextSuccessHandler(key string, handler middleware.SuccessHandler) gin.Handl
 }
 
 func NextWithConfig(config JWTConfig) gin.HandlerFunc {
+	config, extractors := configDefaults(config)
+	return func(c *gin.Context) {
+		if config.Skipper(c) {
+			c.Next()
+			return
+		}
+		token, lastExtractorErr, lastTokenErr := config.authenticate(c, extractors)
+		if token != nil {
+			if config.SuccessHandler != nil {
+				config.SuccessHandler(c)
+			}
+			c.Next()
+			return
+		}
+		if lastExtractorErr != nil {
+			config.ErrorHandler(c, ErrJWTMissing, ErrJWTMissing.Code)
+			return
+		}
+		if lastTokenErr != nil {
+			config.ErrorHandler(c, ErrJWTInvalid, ErrJWTInvalid.Code)
+			return
+		}
+	}
+}
+
+// Authenticator returns a middleware.Authenticator for config to be used with middleware.AuthChainNext.
+// The principal is the parsed token, it is also stored into context under ContextKey.
+func Authenticator(config JWTConfig) middleware.Authenticator {
+	config, extractors := configDefaults(config)
+	return middleware.Authenticator{
+		Scheme: AuthScheme,
+		Authenticate: func(c *gin.Context) (any, error) {
+			token, _, lastTokenErr := config.authenticate(c, extractors)
+			if token != nil {
+				return token, nil
+			}
+			if lastTokenErr != nil {
+				return nil, ErrJWTInvalid
+			}
+			return nil, &middleware.ErrAuthMissing{Err: ErrJWTMissing}
+		},
+	}
+}
+
+func configDefaults(config JWTConfig) (JWTConfig, []middleware.ValuesExtractor) {
 	// Defaults
 	if config.Skipper == nil {
 		config.Skipper = defaultConfig.Skipper
 	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = defaultConfig.ErrorHandler
+	}
 	if config.SigningKey == nil && len(config.SigningKeys) == 0 && config.KeyFunc == nil && config.ParseTokenFunc == nil {
 		panic("IGin: jwt middleware requires signing key")
 	}
@@ -197,41 +247,27 @@ func NextWithConfig(config JWTConfig) gin.HandlerFunc {
 	if cErr != nil {
 		panic(cErr)
 	}
-	return func(c *gin.Context) {
-		if config.Skipper(c) {
-			c.Next()
-			return
+	return config, extractors
+}
+
+// authenticate returns the first valid token and stores it into context.
+func (config *JWTConfig) authenticate(c *gin.Context, extractors []middleware.ValuesExtractor) (token any, lastExtractorErr, lastTokenErr error) {
+	for _, extractor := range extractors {
+		auths, err := extractor(c)
+		if err != nil {
+			lastExtractorErr = ErrJWTMissing
+			continue
 		}
-		var lastExtractorErr error
-		var lastTokenErr error
-		for _, extractor := range extractors {
-			auths, err := extractor(c)
+		for _, auth := range auths {
+			token, err := config.ParseTokenFunc(auth, c)
 			if err != nil {
-				lastExtractorErr = ErrJWTMissing
+				lastTokenErr = err
 				continue
 			}
-			for _, auth := range auths {
-				token, err := config.ParseTokenFunc(auth, c)
-				if err != nil {
-					lastTokenErr = err
-					continue
-				}
-				// Store user information from token into context.
-				c.Set(config.ContextKey, token)
-				if config.SuccessHandler != nil {
-					config.SuccessHandler(c)
-				}
-				c.Next()
-				return
-			}
-		}
-		if lastExtractorErr != nil {
-			config.ErrorHandler(c, ErrJWTMissing, ErrJWTMissing.Code)
-			return
-		}
-		if lastTokenErr != nil {
-			config.ErrorHandler(c, ErrJWTInvalid, ErrJWTInvalid.Code)
-			return
+			// Store user information from token into context.
+			c.Set(config.ContextKey, token)
+			return token, nil, nil
 		}
 	}
+	return nil, lastExtractorErr, lastTokenErr
 }
@@ -0,0 +1,75 @@
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextWithConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sign := func(method jwt.SigningMethod, key any) string {
+		signed, _ := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "igin"}).SignedString(key)
+		return signed
+	}
+	valid := sign(jwt.SigningMethodHS256, []byte("secret"))
+	succeeded := 0
+	engine := func(tokenLookup string) *gin.Engine {
+		g := gin.New()
+		g.Use(NextWithConfig(JWTConfig{
+			SigningKey:     "secret",
+			TokenLookup:    tokenLookup,
+			SuccessHandler: func(c *gin.Context) { succeeded++ },
+		}))
+		g.GET("/", func(c *gin.Context) {
+			token, err := ContextToken(c)
+			if err != nil {
+				c.Status(http.StatusInternalServerError)
+				return
+			}
+			c.String(http.StatusOK, token.Claims.(jwt.MapClaims)["sub"].(string))
+		})
+		return g
+	}
+	header, headerOrCookie := engine(""), engine("header:Authorization,cookie:token")
+	cases := []struct {
+		g      *gin.Engine
+		header string
+		cookie string
+		status int
+	}{
+		{g: header, header: "Bearer " + valid, status: http.StatusOK},
+		{g: header, header: "Bearer " + sign(jwt.SigningMethodHS512, []byte("secret")), status: http.StatusUnauthorized},
+		{g: header, header: "Bearer " + sign(jwt.SigningMethodHS256, []byte("other")), status: http.StatusUnauthorized},
+		{g: header, header: "Basic YWRtaW46c2VjcmV0", status: http.StatusBadRequest},
+		{g: header, status: http.StatusBadRequest},
+		{g: headerOrCookie, cookie: valid, status: http.StatusOK},
+		{g: headerOrCookie, header: "Bearer invalid", cookie: valid, status: http.StatusOK},
+		// a missing source is reported before an invalid token
+		{g: headerOrCookie, header: "Bearer invalid", status: http.StatusBadRequest},
+	}
+	for i, each := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if each.header != "" {
+			req.Header.Set("Authorization", each.header)
+		}
+		if each.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "token", Value: each.cookie})
+		}
+		each.g.ServeHTTP(w, req)
+		assert.Equal(t, each.status, w.Code, i)
+		if each.status == http.StatusOK {
+			assert.Equal(t, "igin", w.Body.String())
+		}
+	}
+	assert.Equal(t, 3, succeeded)
+
+	assert.Panics(t, func() {
+		NextWithConfig(JWTConfig{})
+	})
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/pkg6/igin"
+	"github.com/pkg6/igin/xerror"
 )
 
 type (
@@ -71,6 +72,25 @@ func KeyAuthNext(fn KeyAuthValidator) gin.HandlerFunc {
 }
 
 func KeyAuthNextWithConfig(config KeyAuthConfig) gin.HandlerFunc {
+	config, extractors := keyAuthConfigDefaults(config)
+	return func(c *gin.Context) {
+		if config.Skipper(c) {
+			c.Next()
+			return
+		}
+		if _, err := keyAuthenticate(c, config, extractors); err != nil {
+			if he, ok := err.(*xerror.HTTPError); ok {
+				config.ErrorHandler(c, he, he.Code)
+				return
+			}
+			config.ErrorHandler(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+func keyAuthConfigDefaults(config KeyAuthConfig) (KeyAuthConfig, []ValuesExtractor) {
 	// Defaults
 	if config.Skipper == nil {
 		config.Skipper = defaultKeyAuthConfig.Skipper
@@ -92,58 +112,53 @@ func KeyAuthNextWithConfig(config KeyAuthConfig) gin.HandlerFunc {
 	if cErr != nil {
 		panic(cErr)
 	}
-	return func(c *gin.Context) {
-		if config.Skipper(c) {
-			c.Next()
-			return
+	return config, extractors
+}
+
+// keyAuthenticate returns the first valid key. Validator errors are prioritized over extracting errors,
+// which are returned as *ErrKeyAuthMissing.
+func keyAuthenticate(c *gin.Context, config KeyAuthConfig, extractors []ValuesExtractor) (string, error) {
+	var lastExtractorErr error
+	var lastValidatorErr error
+	for _, extractor := range extractors {
+		keys, err := extractor(c)
+		if err != nil {
+			lastExtractorErr = err
+			continue
 		}
-		var lastExtractorErr error
-		var lastValidatorErr error
-		for _, extractor := range extractors {
-			keys, err := extractor(c)
+		for _, key := range keys {
+			valid, err := config.Validator(key, c)
 			if err != nil {
-				lastExtractorErr = err
+				lastValidatorErr = err
 				continue
 			}
-			for _, key := range keys {
-				valid, err := config.Validator(key, c)
-				if err != nil {
-					lastValidatorErr = err
-					continue
-				}
-				if valid {
-					c.Next()
-					return
-				}
-				lastValidatorErr = errors.New("invalid key")
+			if valid {
+				return key, nil
 			}
+			lastValidatorErr = errors.New("invalid key")
 		}
-		// we are here only when we did not successfully extract and validate any of keys
-		err := lastValidatorErr
-		if err == nil { // prioritize validator errors over extracting errors
-			// ugly part to preserve backwards compatible errors. someone could rely on them
-			if lastExtractorErr == ErrQueryExtractorValueMissing {
-				err = errors.New("missing key in the query string")
-			} else if lastExtractorErr == ErrCookieExtractorValueMissing {
-				err = errors.New("missing key in cookies")
-			} else if lastExtractorErr == ErrFormExtractorValueMissing {
-				err = errors.New("missing key in the form")
-			} else if lastExtractorErr == ErrHeaderExtractorValueMissing {
-				err = errors.New("missing key in request header")
-			} else if lastExtractorErr == ErrHeaderExtractorValueInvalid {
-				err = errors.New("invalid key in the request header")
-			} else {
-				err = lastExtractorErr
-			}
-			err = &ErrKeyAuthMissing{Err: err}
-		}
-		if lastValidatorErr != nil {
-			// prioritize validator errors over extracting errors
-			config.ErrorHandler(c, lastValidatorErr)
-			return
-		}
-		config.ErrorHandler(c, err)
 	}
+	// we are here only when we did not successfully extract and validate any of keys
+	if lastValidatorErr != nil {
+		// prioritize validator errors over extracting errors
+		return "", lastValidatorErr
+	}
+	var err error
+	// ugly part to preserve backwards compatible errors. someone could rely on them
+	if lastExtractorErr == ErrQueryExtractorValueMissing {
+		err = errors.New("missing key in the query string")
+	} else if lastExtractorErr == ErrCookieExtractorValueMissing {
+		err = errors.New("missing key in cookies")
+	} else if lastExtractorErr == ErrFormExtractorValueMissing {
+		err = errors.New("missing key in the form")
+	} else if lastExtractorErr == ErrHeaderExtractorValueMissing {
+		err = errors.New("missing key in request header")
+	} else if lastExtractorErr == ErrHeaderExtractorValueInvalid {
+		err = errors.New("invalid key in the request header")
+	} else {
+		err = lastExtractorErr
+	}
+	return "", &ErrKeyAuthMissing{Err: err}
 }
 
 // ErrKeyAuthMissing is error type when KeyAuth middleware is unable to extract value from lookups
@@ -0,0 +1,291 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin/xT"
+	"github.com/pkg6/igin/xerror"
+)
+
+const (
+	// apiKeySeparator separates the public prefix from the secret part of a raw key: "<prefix>.<secret>"
+	apiKeySeparator   = "."
+	apiKeyPrefixBytes = 4
+	apiKeySecretBytes = 24
+)
+
+type (
+	// APIKey is the stored representation of an api key. The raw key is never stored, only its hash.
+	APIKey struct {
+		// Prefix is the public part of the raw key and is used to look the key up in a KeyStore.
+		Prefix string `json:"prefix"`
+		// Hash is the hex encoded sha256 of the whole raw key.
+		Hash string `json:"hash"`
+		// Owner identifies who the key was issued to.
+		Owner string `json:"owner"`
+		// Scopes granted to the key.
+		Scopes []string `json:"scopes,omitempty"`
+		// ExpiresAt is the time after which the key is rejected. Zero value means the key never expires.
+		ExpiresAt time.Time `json:"expires_at,omitempty"`
+		// Metadata is free form information attached to the key.
+		Metadata map[string]string `json:"metadata,omitempty"`
+	}
+
+	// KeyStore defines the storage used by KeyStoreValidator to resolve api keys.
+	KeyStore interface {
+		// Get returns the key stored under prefix or ErrAPIKeyNotFound.
+		Get(prefix string) (*APIKey, error)
+		// Set stores the key under its prefix, replacing any existing key.
+		Set(key *APIKey) error
+		// Delete removes the key stored under prefix.
+		Delete(prefix string) error
+	}
+)
+
+var (
+	// KeyAuthContextKey is the context key the resolved *APIKey is stored under.
+	KeyAuthContextKey = "key_auth"
+
+	ErrAPIKeyNotFound     = errors.New("api key not found")
+	ErrAPIKeyInvalid      = xerror.NewHTTPError(http.StatusUnauthorized, "invalid key")
+	ErrAPIKeyExpired      = xerror.NewHTTPError(http.StatusUnauthorized, "expired key")
+	ErrAPIKeyInsufficient = xerror.NewHTTPError(http.StatusForbidden, "insufficient key scope")
+)
+
+// NewAPIKey generates a new raw key for owner and the APIKey to be stored for it.
+// The raw key must be handed to the owner, it can not be recovered from the store.
+func NewAPIKey(owner string, scopes ...string) (string, *APIKey, error) {
+	prefix, err := randomHex(apiKeyPrefixBytes)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := randomHex(apiKeySecretBytes)
+	if err != nil {
+		return "", nil, err
+	}
+	raw := prefix + apiKeySeparator + secret
+	return raw, &APIKey{
+		Prefix: prefix,
+		Hash:   HashAPIKey(raw),
+		Owner:  owner,
+		Scopes: scopes,
+	}, nil
+}
+
+// HashAPIKey returns the hex encoded sha256 of raw.
+func HashAPIKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// Expired reports whether the key is expired at t.
+func (k *APIKey) Expired(t time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !t.Before(k.ExpiresAt)
+}
+
+// HasScopes reports whether the key was granted all scopes.
+func (k *APIKey) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		if !xT.Contains(k.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// KeyStoreValidator returns a KeyAuthValidator resolving keys from store.
+// The raw key hash is compared in constant time, expired keys and keys missing any of scopes are rejected.
+// For a valid key the *APIKey is stored into context under KeyAuthContextKey.
+func KeyStoreValidator(store KeyStore, scopes ...string) KeyAuthValidator {
+	if store == nil {
+		panic("IGin: key-auth validator requires a key store")
+	}
+	return func(auth string, c *gin.Context) (bool, error) {
+		prefix, _, found := strings.Cut(auth, apiKeySeparator)
+		if !found || prefix == "" {
+			return false, ErrAPIKeyInvalid
+		}
+		key, err := store.Get(prefix)
+		if err != nil {
+			if errors.Is(err, ErrAPIKeyNotFound) {
+				return false, ErrAPIKeyInvalid
+			}
+			return false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(HashAPIKey(auth)), []byte(key.Hash)) != 1 {
+			return false, ErrAPIKeyInvalid
+		}
+		if key.Expired(time.Now()) {
+			return false, ErrAPIKeyExpired
+		}
+		if !key.HasScopes(scopes...) {
+			return false, ErrAPIKeyInsufficient
+		}
+		c.Set(KeyAuthContextKey, key)
+		return true, nil
+	}
+}
+
+// KeyAuthNextWithStore returns an KeyAuth middleware validating keys against store.
+func KeyAuthNextWithStore(store KeyStore, scopes ...string) gin.HandlerFunc {
+	return KeyAuthNext(KeyStoreValidator(store, scopes...))
+}
+
+// ContextAPIKey returns the key resolved by KeyStoreValidator.
+func ContextAPIKey(c *gin.Context) (*APIKey, error) {
+	if value, exists := c.Get(KeyAuthContextKey); exists {
+		if key, ok := value.(*APIKey); ok {
+			return key, nil
+		}
+	}
+	return nil, errors.New("api key information does not exist")
+}
+
+// MemoryKeyStore is an in-memory KeyStore.
+type MemoryKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]*APIKey
+}
+
+// NewMemoryKeyStore returns a MemoryKeyStore holding keys.
+func NewMemoryKeyStore(keys ...*APIKey) *MemoryKeyStore {
+	s := &MemoryKeyStore{keys: make(map[string]*APIKey, len(keys))}
+	for _, key := range keys {
+		s.keys[key.Prefix] = key
+	}
+	return s
+}
+
+func (s *MemoryKeyStore) Get(prefix string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[prefix]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func (s *MemoryKeyStore) Set(key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key.Prefix] = key
+	return nil
+}
+
+func (s *MemoryKeyStore) Delete(prefix string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, prefix)
+	return nil
+}
+
+// Keys returns all stored keys.
+func (s *MemoryKeyStore) Keys() []*APIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]*APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (s *MemoryKeyStore) replace(keys []*APIKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = make(map[string]*APIKey, len(keys))
+	for _, key := range keys {
+		s.keys[key.Prefix] = key
+	}
+}
+
+// FileKeyStore is a KeyStore persisted as a json array in a file.
+// Every change rewrites the whole file.
+type FileKeyStore struct {
+	*MemoryKeyStore
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileKeyStore returns a FileKeyStore backed by path. A missing file is treated as an empty store.
+func NewFileKeyStore(path string) (*FileKeyStore, error) {
+	s := &FileKeyStore{MemoryKeyStore: NewMemoryKeyStore(), path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload replaces the stored keys with the content of the file.
+func (s *FileKeyStore) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var keys []*APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	s.MemoryKeyStore.replace(keys)
+	return nil
+}
+
+func (s *FileKeyStore) Set(key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.MemoryKeyStore.Set(key)
+	return s.save()
+}
+
+func (s *FileKeyStore) Delete(prefix string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.MemoryKeyStore.Delete(prefix)
+	return s.save()
+}
+
+func (s *FileKeyStore) save() error {
+	data, err := json.MarshalIndent(s.MemoryKeyStore.Keys(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func keyStoreRequest(store KeyStore, key string, scopes ...string) (*httptest.ResponseRecorder, *APIKey) {
+	var resolved *APIKey
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.Use(KeyAuthNextWithStore(store, scopes...))
+	g.GET("/", func(c *gin.Context) {
+		resolved, _ = ContextAPIKey(c)
+		c.Status(http.StatusOK)
+	})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+key)
+	g.ServeHTTP(w, req)
+	return w, resolved
+}
+
+func TestKeyStoreValidator(t *testing.T) {
+	raw, key, err := NewAPIKey("igin", "read")
+	assert.NoError(t, err)
+	store := NewMemoryKeyStore(key)
+
+	w, resolved := keyStoreRequest(store, raw, "read")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "igin", resolved.Owner)
+
+	w, _ = keyStoreRequest(store, raw+"x")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w, _ = keyStoreRequest(store, raw, "write")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	key.ExpiresAt = time.Now().Add(-time.Second)
+	w, _ = keyStoreRequest(store, raw)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestFileKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	store, err := NewFileKeyStore(path)
+	assert.NoError(t, err)
+	raw, key, err := NewAPIKey("igin")
+	assert.NoError(t, err)
+	assert.NoError(t, store.Set(key))
+
+	reopened, err := NewFileKeyStore(path)
+	assert.NoError(t, err)
+	w, _ := keyStoreRequest(reopened, raw)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.NoError(t, store.Delete(key.Prefix))
+	assert.NoError(t, reopened.Reload())
+	_, err = reopened.Get(key.Prefix)
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+)
+
+type (
+	// MethodOverrideConfig defines the config for MethodOverride middleware.
+	MethodOverrideConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+		// MethodLookup is a string in the form of "<source>:<name>" or "<source>:<name>,<source>:<name>" that is used
+		// to extract the method from the request, the first source with a value wins.
+		// Optional. Default value "header:X-HTTP-Method-Override,form:_method".
+		MethodLookup string
+		// Methods are the methods a POST request may be changed to, other values are ignored.
+		// Optional. Default value []string{"PUT", "PATCH", "DELETE"}.
+		Methods []string
+	}
+)
+
+var (
+	// DefaultMethodOverrideConfig is the default MethodOverride middleware config.
+	defaultMethodOverrideConfig = MethodOverrideConfig{
+		Skipper:      DefaultSkipper,
+		MethodLookup: ExtractorMethodHeader + ":" + igin.HeaderXHTTPMethodOverride + "," + ExtractorMethodForm + ":_method",
+		Methods:      []string{http.MethodPut, http.MethodPatch, http.MethodDelete},
+	}
+)
+
+// MethodOverrideNext returns a MethodOverride middleware.
+//
+// Register it with igin.Engine.Pre, gin routes the request before running middleware.
+func MethodOverrideNext() gin.HandlerFunc {
+	return MethodOverrideNextWithConfig(defaultMethodOverrideConfig)
+}
+
+// MethodOverrideNextWithConfig returns a MethodOverride middleware with config.
+//
+// POST requests are changed to the method found by MethodLookup when it is allowed. Register it with
+// igin.Engine.Pre so the request is routed with the new method:
+//
+//	e := igin.New()
+//	e.Pre(middleware.MethodOverrideNext())
+//	e.DELETE("/users/:id", deleteUser) // <form method="post"><input type="hidden" name="_method" value="DELETE">
+func MethodOverrideNextWithConfig(config MethodOverrideConfig) gin.HandlerFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = defaultMethodOverrideConfig.Skipper
+	}
+	if config.MethodLookup == "" {
+		config.MethodLookup = defaultMethodOverrideConfig.MethodLookup
+	}
+	if len(config.Methods) == 0 {
+		config.Methods = defaultMethodOverrideConfig.Methods
+	}
+	extractors, cErr := CreateExtractors(config.MethodLookup, "")
+	if cErr != nil {
+		panic(cErr)
+	}
+	allowed := make(map[string]bool, len(config.Methods))
+	for _, method := range config.Methods {
+		allowed[strings.ToUpper(method)] = true
+	}
+	return func(c *gin.Context) {
+		if config.Skipper(c) || c.Request.Method != http.MethodPost {
+			return
+		}
+		for _, extractor := range extractors {
+			values, err := extractor(c)
+			if err != nil || len(values) == 0 || values[0] == "" {
+				continue
+			}
+			if method := strings.ToUpper(strings.TrimSpace(values[0])); allowed[method] {
+				c.Request.Method = method
+			}
+			return
+		}
+	}
+}
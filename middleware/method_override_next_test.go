@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMethodOverrideNext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := igin.New()
+	e.HandleMethodNotAllowed = true
+	e.Pre(MethodOverrideNext())
+	e.DELETE("/users/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, "deleted %s %s", c.Param("id"), c.PostForm("reason"))
+	})
+	e.PUT("/users/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, "updated %s", c.Param("id"))
+	})
+
+	serve := func(method, target string, form url.Values, headers ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set(igin.HeaderContentType, gin.MIMEPOSTForm)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(http.MethodPost, "/users/1", url.Values{"_method": {"delete"}, "reason": {"spam"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "deleted 1 spam", w.Body.String(), "the form stays readable")
+	assert.Equal(t, "updated 2", serve(http.MethodPost, "/users/2", nil, igin.HeaderXHTTPMethodOverride, "PUT").Body.String())
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPost, "/users/3", url.Values{"_method": {"TRACE"}}).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodGet, "/users/4", nil, igin.HeaderXHTTPMethodOverride, "DELETE").Code)
+
+	e = igin.New()
+	e.Pre(MethodOverrideNextWithConfig(MethodOverrideConfig{MethodLookup: "query:_method", Methods: []string{http.MethodPatch}}))
+	e.PATCH("/users/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, "patched %s", c.Param("id"))
+	})
+	assert.Equal(t, "patched 5", serve(http.MethodPost, "/users/5?_method=PATCH", nil).Body.String())
+}
@@ -0,0 +1,311 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg6/igin"
+	"github.com/pkg6/igin/middleware"
+	"github.com/pkg6/igin/middleware/session"
+	"github.com/pkg6/igin/xerror"
+)
+
+const (
+	sessionState    = "state"
+	sessionNonce    = "nonce"
+	sessionVerifier = "verifier"
+	sessionReturnTo = "return_to"
+	sessionIDToken  = "id_token"
+	sessionExpires  = "expires"
+)
+
+type (
+	// Config defines the config for the OIDC plugin.
+	Config struct {
+		// Issuer is the provider issuer url, the metadata is discovered from it.
+		// Required.
+		Issuer string
+		// ClientID of the application registered at the provider.
+		// Required.
+		ClientID string
+		// ClientSecret of the application, leave empty for public clients.
+		ClientSecret string
+		// RedirectURL is the absolute url of the callback route, e.g. "https://example.com/auth/callback".
+		// Required.
+		RedirectURL string
+		// Scopes requested.
+		// Optional. Default value []string{"openid", "profile", "email"}.
+		Scopes []string
+		// Path the plugin is registered under.
+		// Optional. Default value "/auth".
+		Path string
+		// SessionName is the name of the session the login state and claims are stored in.
+		// Optional. Default value "_oidc".
+		SessionName string
+		// AfterLoginURL is the redirect target after login when the login was not started by Next.
+		// Optional. Default value "/".
+		AfterLoginURL string
+		// AfterLogoutURL is the redirect target after logout.
+		// Optional. Default value "/".
+		AfterLogoutURL string
+		// HTTPClient used to talk to the provider.
+		// Optional. Default value http.DefaultClient.
+		HTTPClient *http.Client
+		// ErrorHandler defines a function which is executed for failed logins and unauthenticated api requests.
+		// Optional. Default value middleware.DefaultErrorHandler.
+		ErrorHandler middleware.ErrorHandler
+		// SuccessHandler defines a function which is executed after a successful login before redirecting.
+		// Optional.
+		SuccessHandler middleware.SuccessHandler
+	}
+
+	// Provider is an igin.IPlugin implementing the authorization code flow with PKCE.
+	// It requires the session middleware, the id token is kept in the session so large tokens may need a
+	// server side store such as session.NewMemoryStore instead of the 4KB cookie store.
+	Provider struct {
+		Metadata *Metadata
+		config   Config
+		keys     *keySet
+	}
+)
+
+var (
+	ContextKey = "user"
+	// DefaultConfig is the default OIDC config.
+	defaultConfig = Config{
+		Scopes:         []string{"openid", "profile", "email"},
+		Path:           "/auth",
+		SessionName:    "_oidc",
+		AfterLoginURL:  "/",
+		AfterLogoutURL: "/",
+		ErrorHandler:   middleware.DefaultErrorHandler,
+	}
+	ErrUnauthenticated = xerror.NewHTTPError(http.StatusUnauthorized, "unauthenticated")
+	ErrInvalidState    = xerror.NewHTTPError(http.StatusBadRequest, "invalid oidc state")
+	ErrLoginFailed     = xerror.NewHTTPError(http.StatusUnauthorized, "oidc login failed")
+)
+
+var _ igin.IPlugin = (*Provider)(nil)
+
+// New discovers the provider metadata and returns the plugin.
+func New(config Config) (*Provider, error) {
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("IGin: oidc requires issuer, client id and redirect url")
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = defaultConfig.Scopes
+	}
+	if config.Path == "" {
+		config.Path = defaultConfig.Path
+	}
+	if config.SessionName == "" {
+		config.SessionName = defaultConfig.SessionName
+	}
+	if config.AfterLoginURL == "" {
+		config.AfterLoginURL = defaultConfig.AfterLoginURL
+	}
+	if config.AfterLogoutURL == "" {
+		config.AfterLogoutURL = defaultConfig.AfterLogoutURL
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = defaultConfig.ErrorHandler
+	}
+	metadata, err := Discover(context.Background(), config.HTTPClient, config.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	return &Provider{
+		Metadata: metadata,
+		config:   config,
+		keys:     &keySet{client: config.HTTPClient, uri: metadata.JwksURI},
+	}, nil
+}
+
+// RouterPath igin.IPlugin
+func (p *Provider) RouterPath() string {
+	return p.config.Path
+}
+
+// Register igin.IPlugin registers the login, callback and logout routes.
+// Logout only accepts POST so other sites can not log users out with a link or an image.
+func (p *Provider) Register(group *gin.RouterGroup) {
+	group.GET("/login", p.login)
+	group.GET("/callback", p.callback)
+	group.POST("/logout", p.logout)
+}
+
+// LoginPath is the absolute path of the login route.
+func (p *Provider) LoginPath() string {
+	return path.Join("/", p.config.Path, "login")
+}
+
+// Next returns a middleware requiring a logged-in user.
+// The claims are stored into context under ContextKey. Unauthenticated browser requests are
+// redirected to the login route and come back afterwards, other requests get ErrUnauthenticated.
+func (p *Provider) Next() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if claims, ok := p.claims(c); ok {
+			c.Set(ContextKey, claims)
+			c.Next()
+			return
+		}
+		if c.Request.Method == http.MethodGet && strings.Contains(c.GetHeader(igin.HeaderAccept), igin.MIMETextHTML) {
+			c.Redirect(http.StatusFound, p.LoginPath()+"?"+url.Values{sessionReturnTo: {c.Request.URL.RequestURI()}}.Encode())
+			c.Abort()
+			return
+		}
+		p.config.ErrorHandler(c, ErrUnauthenticated, ErrUnauthenticated.Code)
+	}
+}
+
+// ContextClaims returns the id token claims stored by Provider.Next.
+func ContextClaims(c *gin.Context) (jwt.MapClaims, error) {
+	if value, exists := c.Get(ContextKey); exists {
+		if claims, ok := value.(jwt.MapClaims); ok {
+			return claims, nil
+		}
+	}
+	return nil, errors.New("user information does not exist")
+}
+
+func (p *Provider) claims(c *gin.Context) (jwt.MapClaims, bool) {
+	sess, err := session.Session(c, p.config.SessionName)
+	if err != nil {
+		return nil, false
+	}
+	idToken, _ := sess.Values[sessionIDToken].(string)
+	expires, _ := sess.Values[sessionExpires].(int64)
+	if idToken == "" || time.Now().Unix() >= expires {
+		return nil, false
+	}
+	// verified on login, the session is trusted
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(idToken, claims); err != nil {
+		return nil, false
+	}
+	return claims, true
+}
+
+func (p *Provider) login(c *gin.Context) {
+	sess, err := session.Session(c, p.config.SessionName)
+	if err != nil {
+		p.config.ErrorHandler(c, err, http.StatusInternalServerError)
+		return
+	}
+	state, nonce, verifier := randomString(), randomString(), randomString()
+	sess.Values[sessionState] = state
+	sess.Values[sessionNonce] = nonce
+	sess.Values[sessionVerifier] = verifier
+	sess.Values[sessionReturnTo] = safeReturnTo(c.Query(sessionReturnTo), p.config.AfterLoginURL)
+	if err := sess.Save(c.Request, c.Writer); err != nil {
+		p.config.ErrorHandler(c, err, http.StatusInternalServerError)
+		return
+	}
+	c.Redirect(http.StatusFound, p.AuthCodeURL(state, nonce, verifier))
+}
+
+func (p *Provider) callback(c *gin.Context) {
+	sess, err := session.Session(c, p.config.SessionName)
+	if err != nil {
+		p.config.ErrorHandler(c, err, http.StatusInternalServerError)
+		return
+	}
+	state, _ := sess.Values[sessionState].(string)
+	nonce, _ := sess.Values[sessionNonce].(string)
+	verifier, _ := sess.Values[sessionVerifier].(string)
+	returnTo, _ := sess.Values[sessionReturnTo].(string)
+	delete(sess.Values, sessionState)
+	delete(sess.Values, sessionNonce)
+	delete(sess.Values, sessionVerifier)
+	delete(sess.Values, sessionReturnTo)
+	// the state is single use, it is consumed before anything is checked
+	if err := sess.Save(c.Request, c.Writer); err != nil {
+		p.config.ErrorHandler(c, err, http.StatusInternalServerError)
+		return
+	}
+	if state == "" || c.Query("state") != state {
+		p.config.ErrorHandler(c, ErrInvalidState, ErrInvalidState.Code)
+		return
+	}
+	if c.Query("error") != "" {
+		p.config.ErrorHandler(c, xerror.NewHTTPError(ErrLoginFailed.Code, c.Query("error")), ErrLoginFailed.Code)
+		return
+	}
+	token, err := p.Exchange(c.Request.Context(), c.Query("code"), verifier)
+	if err != nil {
+		_ = c.Error(err)
+		p.config.ErrorHandler(c, ErrLoginFailed, ErrLoginFailed.Code)
+		return
+	}
+	claims, err := p.Verify(c.Request.Context(), token.IDToken, nonce)
+	if err != nil {
+		_ = c.Error(err)
+		p.config.ErrorHandler(c, ErrLoginFailed, ErrLoginFailed.Code)
+		return
+	}
+	// a new session id for the logged-in user prevents session fixation
+	if err := session.Regenerate(c, p.config.SessionName); err != nil {
+		p.config.ErrorHandler(c, err, http.StatusInternalServerError)
+		return
+	}
+	expires, _ := claims["exp"].(float64)
+	sess.Values[sessionIDToken] = token.IDToken
+	sess.Values[sessionExpires] = int64(expires)
+	if err := sess.Save(c.Request, c.Writer); err != nil {
+		p.config.ErrorHandler(c, err, http.StatusInternalServerError)
+		return
+	}
+	c.Set(ContextKey, claims)
+	if p.config.SuccessHandler != nil {
+		p.config.SuccessHandler(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+	if returnTo == "" {
+		returnTo = p.config.AfterLoginURL
+	}
+	c.Redirect(http.StatusFound, returnTo)
+}
+
+func (p *Provider) logout(c *gin.Context) {
+	sess, err := session.Session(c, p.config.SessionName)
+	if err != nil {
+		p.config.ErrorHandler(c, err, http.StatusInternalServerError)
+		return
+	}
+	idToken, _ := sess.Values[sessionIDToken].(string)
+	sess.Values = map[interface{}]interface{}{}
+	sess.Options.MaxAge = -1
+	if err := sess.Save(c.Request, c.Writer); err != nil {
+		p.config.ErrorHandler(c, err, http.StatusInternalServerError)
+		return
+	}
+	target := p.config.AfterLogoutURL
+	if p.Metadata.EndSessionEndpoint != "" && idToken != "" {
+		v := url.Values{"id_token_hint": {idToken}, "client_id": {p.config.ClientID}}
+		if u, err := url.Parse(target); err == nil && u.IsAbs() {
+			v.Set("post_logout_redirect_uri", target)
+		}
+		target = p.Metadata.EndSessionEndpoint + "?" + v.Encode()
+	}
+	c.Redirect(http.StatusFound, target)
+}
+
+// safeReturnTo only accepts local paths to avoid open redirects.
+func safeReturnTo(returnTo, fallback string) string {
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		return fallback
+	}
+	return returnTo
+}
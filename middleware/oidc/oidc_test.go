@@ -0,0 +1,171 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/sessions"
+	"github.com/pkg6/igin"
+	"github.com/pkg6/igin/middleware/session"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubProvider is a minimal OpenID provider issuing id tokens for any code.
+func stubProvider(t *testing.T, clientID string) (*httptest.Server, *string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	nonce := new(string)
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"issuer":"` + srv.URL + `","authorization_endpoint":"` + srv.URL + `/authorize","token_endpoint":"` + srv.URL + `/token","jwks_uri":"` + srv.URL + `/jwks"}`))
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		n := base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+		e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+		_, _ = w.Write([]byte(`{"keys":[{"kty":"RSA","kid":"k1","n":"` + n + `","e":"` + e + `"}]}`))
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "code" || r.PostFormValue("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":   srv.URL,
+			"aud":   clientID,
+			"sub":   "igin",
+			"nonce": *nonce,
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		})
+		token.Header["kid"] = "k1"
+		signed, _ := token.SignedString(key)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"a","token_type":"Bearer","id_token":"` + signed + `"}`))
+	})
+	return srv, nonce
+}
+
+type testApp struct {
+	t     *testing.T
+	url   string
+	jar   *cookiejar.Jar
+	nonce *string
+	do    func(method, u, accept string) *http.Response
+}
+
+func newTestApp(t *testing.T, store sessions.Store) (*testApp, func()) {
+	gin.SetMode(gin.TestMode)
+	idp, nonce := stubProvider(t, "client")
+	g := igin.New()
+	app := httptest.NewServer(g)
+	provider, err := New(Config{Issuer: idp.URL, ClientID: "client", RedirectURL: app.URL + "/auth/callback"})
+	assert.NoError(t, err)
+	g.Use(session.NextWithStore(store))
+	g.Plugin(provider)
+	g.GET("/admin", provider.Next(), func(c *gin.Context) {
+		claims, _ := ContextClaims(c)
+		c.String(http.StatusOK, claims["sub"].(string))
+	})
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar, CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	do := func(method, u string, accept string) *http.Response {
+		req, _ := http.NewRequest(method, u, nil)
+		req.Header.Set("Accept", accept)
+		resp, err := client.Do(req)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	return &testApp{t: t, url: app.URL, jar: jar, nonce: nonce, do: do}, func() {
+		app.Close()
+		idp.Close()
+	}
+}
+
+func (a *testApp) get(path, accept string) *http.Response {
+	return a.do(http.MethodGet, a.url+path, accept)
+}
+
+// login starts a login and returns the state sent to the provider.
+func (a *testApp) login() string {
+	resp := a.get("/auth/login?return_to=/admin", "text/html")
+	authorize, _ := url.Parse(resp.Header.Get("Location"))
+	*a.nonce = authorize.Query().Get("nonce")
+	return authorize.Query().Get("state")
+}
+
+func (a *testApp) cookie() string {
+	u, _ := url.Parse(a.url)
+	for _, cookie := range a.jar.Cookies(u) {
+		if cookie.Name == "_oidc" {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+func (a *testApp) setCookie(value string) {
+	u, _ := url.Parse(a.url)
+	a.jar.SetCookies(u, []*http.Cookie{{Name: "_oidc", Value: value, Path: "/"}})
+}
+
+func TestProvider(t *testing.T) {
+	app, closeApp := newTestApp(t, sessions.NewCookieStore([]byte("secret")))
+	defer closeApp()
+
+	assert.Equal(t, http.StatusUnauthorized, app.get("/admin", "application/json").StatusCode)
+
+	resp := app.get("/admin", "text/html")
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	resp = app.get(resp.Header.Get("Location"), "text/html")
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	authorize, _ := url.Parse(resp.Header.Get("Location"))
+	assert.Equal(t, "S256", authorize.Query().Get("code_challenge_method"))
+
+	resp = app.get("/auth/callback?code=code&state=wrong", "text/html")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = app.get("/auth/callback?code=code&state="+app.login(), "text/html")
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "/admin", resp.Header.Get("Location"))
+	assert.Equal(t, http.StatusOK, app.get("/admin", "text/html").StatusCode)
+
+	assert.NotEqual(t, http.StatusFound, app.get("/auth/logout", "text/html").StatusCode, "no logout on GET")
+	assert.Equal(t, http.StatusOK, app.get("/admin", "text/html").StatusCode)
+	assert.Equal(t, http.StatusFound, app.do(http.MethodPost, app.url+"/auth/logout", "text/html").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, app.get("/admin", "application/json").StatusCode)
+}
+
+func TestProviderSession(t *testing.T) {
+	app, closeApp := newTestApp(t, session.NewMemoryStore([]byte("secret")))
+	defer closeApp()
+
+	state := app.login()
+	resp := app.get("/auth/callback?error=access_denied&state="+state, "text/html")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = app.get("/auth/callback?code=code&state="+state, "text/html")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "a failed callback consumes the state")
+
+	state = app.login()
+	before := app.cookie()
+	resp = app.get("/auth/callback?code=code&state="+state, "text/html")
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, http.StatusOK, app.get("/admin", "text/html").StatusCode)
+	app.setCookie(before)
+	assert.Equal(t, http.StatusUnauthorized, app.get("/admin", "application/json").StatusCode,
+		"the session id is rotated on login, the pre-login session is not logged in")
+}
@@ -0,0 +1,408 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/pkg6/igin/xerror"
+)
+
+type (
+	// ProxyConfig defines the config for Proxy middleware.
+	ProxyConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+		// ErrorHandler defines a function which is executed when no upstream could serve the request.
+		ErrorHandler ErrorHandler
+		// Targets are the upstream servers.
+		// Required.
+		Targets []*ProxyTarget
+		// Balancer picks the target of every attempt among the healthy ones.
+		// Optional. Default value NewRoundRobinBalancer().
+		Balancer ProxyBalancer
+		// Rewrite defines path rewrite rules, every "*" captures a group referenced as $1, $2...
+		// Example:
+		// "/api/*":  "/$1",
+		// "/users/*/orders": "/orders?user=$1",
+		Rewrite map[string]string
+		// Retries is the number of additional attempts on other targets for failed idempotent requests without body.
+		// Optional. Default value 0.
+		Retries int
+		// Transport used to reach the targets.
+		// Optional. Default value http.DefaultTransport.
+		Transport http.RoundTripper
+		// MaxFails marks a target down after the given number of consecutive failures (passive health check).
+		// Optional. Default value 3.
+		MaxFails int
+		// FailTimeout is how long a target marked down by passive checks is skipped.
+		// Optional. Default value 10 seconds.
+		FailTimeout time.Duration
+		// HealthCheckPath enables active health checks, targets answering with a status >= 500 or not at all are down.
+		// Optional.
+		HealthCheckPath string
+		// HealthCheckInterval between active health checks.
+		// Optional. Default value 10 seconds.
+		HealthCheckInterval time.Duration
+		// ModifyResponse modifies the upstream response, see httputil.ReverseProxy.
+		// Optional.
+		ModifyResponse func(*http.Response) error
+		// TrustedProxies are the CIDRs of the proxies whose X-Forwarded-* and X-Real-Ip headers are passed on,
+		// the headers of other peers are replaced with the peer address and TLS state.
+		// Optional.
+		TrustedProxies []string
+	}
+
+	// ProxyTarget is an upstream server.
+	ProxyTarget struct {
+		Name string
+		URL  *url.URL
+		// Meta holds arbitrary data for custom balancers.
+		Meta map[string]any
+
+		conns     int64
+		fails     int64
+		downUntil int64 // unix nano, passive checks
+		unhealthy int32 // active checks
+	}
+
+	// ProxyBalancer picks a target among the healthy targets, targets is never empty.
+	ProxyBalancer interface {
+		Next(c *gin.Context, targets []*ProxyTarget) *ProxyTarget
+	}
+
+	// Proxy is a reverse proxy middleware, Close stops its active health checks.
+	Proxy struct {
+		config  ProxyConfig
+		rules   []rewriteRule
+		trusted []*net.IPNet
+		proxies map[*ProxyTarget]*httputil.ReverseProxy
+		stop    chan struct{}
+		stopped sync.Once
+	}
+
+	roundRobinBalancer struct {
+		i uint32
+	}
+	randomBalancer     struct{}
+	leastConnsBalancer struct{}
+
+	proxyErrorKey struct{}
+)
+
+var (
+	// DefaultProxyConfig is the default Proxy middleware config.
+	defaultProxyConfig = ProxyConfig{
+		Skipper:             DefaultSkipper,
+		ErrorHandler:        DefaultErrorHandler,
+		MaxFails:            3,
+		FailTimeout:         10 * time.Second,
+		HealthCheckInterval: 10 * time.Second,
+	}
+	ErrProxyBadGateway = xerror.NewHTTPError(http.StatusBadGateway, "bad gateway")
+	ErrProxyNoTarget   = xerror.NewHTTPError(http.StatusBadGateway, "no healthy upstream")
+)
+
+// NewProxyTarget returns a target for rawURL, e.g. "http://10.0.0.1:8080/api".
+func NewProxyTarget(rawURL string) (*ProxyTarget, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, errors.New("IGin: proxy target requires an absolute url: " + rawURL)
+	}
+	return &ProxyTarget{Name: u.Host, URL: u}, nil
+}
+
+// Healthy reports whether the target passes the active and passive health checks.
+func (t *ProxyTarget) Healthy() bool {
+	return atomic.LoadInt32(&t.unhealthy) == 0 && time.Now().UnixNano() >= atomic.LoadInt64(&t.downUntil)
+}
+
+// Conns returns the number of requests in flight.
+func (t *ProxyTarget) Conns() int64 {
+	return atomic.LoadInt64(&t.conns)
+}
+
+// NewRoundRobinBalancer returns a balancer cycling through the targets.
+func NewRoundRobinBalancer() ProxyBalancer {
+	return &roundRobinBalancer{}
+}
+
+// NewRandomBalancer returns a balancer picking a random target.
+func NewRandomBalancer() ProxyBalancer {
+	return randomBalancer{}
+}
+
+// NewLeastConnsBalancer returns a balancer picking the target with the fewest requests in flight.
+func NewLeastConnsBalancer() ProxyBalancer {
+	return leastConnsBalancer{}
+}
+
+func (b *roundRobinBalancer) Next(c *gin.Context, targets []*ProxyTarget) *ProxyTarget {
+	return targets[(atomic.AddUint32(&b.i, 1)-1)%uint32(len(targets))]
+}
+
+func (randomBalancer) Next(c *gin.Context, targets []*ProxyTarget) *ProxyTarget {
+	return targets[rand.Intn(len(targets))]
+}
+
+func (leastConnsBalancer) Next(c *gin.Context, targets []*ProxyTarget) *ProxyTarget {
+	best := targets[0]
+	for _, target := range targets[1:] {
+		if target.Conns() < best.Conns() {
+			best = target
+		}
+	}
+	return best
+}
+
+// ProxyNext returns a round-robin Proxy middleware for the given target urls.
+func ProxyNext(targets ...string) gin.HandlerFunc {
+	c := defaultProxyConfig
+	for _, rawURL := range targets {
+		target, err := NewProxyTarget(rawURL)
+		if err != nil {
+			panic(err)
+		}
+		c.Targets = append(c.Targets, target)
+	}
+	return ProxyNextWithConfig(c)
+}
+
+// ProxyNextWithConfig returns a Proxy middleware with config.
+// Active health checks run for the lifetime of the process, use NewProxy to stop them.
+func ProxyNextWithConfig(config ProxyConfig) gin.HandlerFunc {
+	return NewProxy(config).Next()
+}
+
+// NewProxy returns a Proxy and starts the active health checks when configured.
+//
+// Requests are forwarded with X-Forwarded-For, X-Forwarded-Host, X-Forwarded-Proto and X-Real-Ip, incoming values
+// are only kept from TrustedProxies. WebSocket
+// upgrades are passed through. Upstream errors are rendered through ErrorHandler with ErrProxyBadGateway.
+func NewProxy(config ProxyConfig) *Proxy {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = defaultProxyConfig.Skipper
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = defaultProxyConfig.ErrorHandler
+	}
+	if config.Balancer == nil {
+		config.Balancer = NewRoundRobinBalancer()
+	}
+	if config.Transport == nil {
+		config.Transport = http.DefaultTransport
+	}
+	if config.MaxFails == 0 {
+		config.MaxFails = defaultProxyConfig.MaxFails
+	}
+	if config.FailTimeout == 0 {
+		config.FailTimeout = defaultProxyConfig.FailTimeout
+	}
+	if config.HealthCheckInterval == 0 {
+		config.HealthCheckInterval = defaultProxyConfig.HealthCheckInterval
+	}
+	if len(config.Targets) == 0 {
+		panic("IGin: proxy middleware requires targets")
+	}
+	trusted, err := ParseCIDRs(config.TrustedProxies)
+	if err != nil {
+		panic(err)
+	}
+	p := &Proxy{
+		config:  config,
+		rules:   compileRewrites(config.Rewrite),
+		trusted: trusted,
+		proxies: make(map[*ProxyTarget]*httputil.ReverseProxy, len(config.Targets)),
+		stop:    make(chan struct{}),
+	}
+	for _, target := range config.Targets {
+		p.proxies[target] = p.reverseProxy(target)
+	}
+	if config.HealthCheckPath != "" {
+		go p.healthCheck()
+	}
+	return p
+}
+
+// Close stops the active health checks.
+func (p *Proxy) Close() {
+	p.stopped.Do(func() {
+		close(p.stop)
+	})
+}
+
+// Next returns the middleware.
+func (p *Proxy) Next() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if p.config.Skipper(c) {
+			c.Next()
+			return
+		}
+		attempts := 1
+		if p.retryable(c.Request) {
+			attempts += p.config.Retries
+		}
+		tried := map[*ProxyTarget]bool{}
+		for attempt := 0; attempt < attempts; attempt++ {
+			target := p.pick(c, tried)
+			if target == nil {
+				break
+			}
+			tried[target] = true
+			var proxyErr error
+			req := c.Request.WithContext(context.WithValue(c.Request.Context(), proxyErrorKey{}, &proxyErr))
+			atomic.AddInt64(&target.conns, 1)
+			p.proxies[target].ServeHTTP(c.Writer, req)
+			atomic.AddInt64(&target.conns, -1)
+			if proxyErr == nil {
+				atomic.StoreInt64(&target.fails, 0)
+				c.Abort()
+				return
+			}
+			_ = c.Error(proxyErr)
+			if errors.Is(proxyErr, context.Canceled) {
+				// the client went away
+				c.Abort()
+				return
+			}
+			if atomic.AddInt64(&target.fails, 1) >= int64(p.config.MaxFails) {
+				atomic.StoreInt64(&target.downUntil, time.Now().Add(p.config.FailTimeout).UnixNano())
+				atomic.StoreInt64(&target.fails, 0)
+			}
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+		}
+		if len(tried) == 0 {
+			p.config.ErrorHandler(c, ErrProxyNoTarget, ErrProxyNoTarget.Code)
+			return
+		}
+		p.config.ErrorHandler(c, ErrProxyBadGateway, ErrProxyBadGateway.Code)
+	}
+}
+
+func (p *Proxy) pick(c *gin.Context, tried map[*ProxyTarget]bool) *ProxyTarget {
+	healthy := make([]*ProxyTarget, 0, len(p.config.Targets))
+	for _, target := range p.config.Targets {
+		if !tried[target] && target.Healthy() {
+			healthy = append(healthy, target)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+	return p.config.Balancer.Next(c, healthy)
+}
+
+// retryable reports whether the request is idempotent and has no body to replay.
+func (p *Proxy) retryable(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0
+	}
+	return false
+}
+
+func (p *Proxy) reverseProxy(target *ProxyTarget) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			p.direct(target, req)
+		},
+		Transport:      p.config.Transport,
+		ModifyResponse: p.config.ModifyResponse,
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			if proxyErr, ok := req.Context().Value(proxyErrorKey{}).(*error); ok {
+				*proxyErr = err
+			}
+		},
+	}
+}
+
+func (p *Proxy) direct(target *ProxyTarget, req *http.Request) {
+	rewriteURL(p.rules, req.URL)
+	rawQuery := req.URL.RawQuery
+	req.URL.Scheme = target.URL.Scheme
+	req.URL.Host = target.URL.Host
+	req.URL.Path = joinURLPath(target.URL.Path, req.URL.Path)
+	req.URL.RawPath = ""
+	switch {
+	case target.URL.RawQuery == "":
+		req.URL.RawQuery = rawQuery
+	case rawQuery == "":
+		req.URL.RawQuery = target.URL.RawQuery
+	default:
+		req.URL.RawQuery = target.URL.RawQuery + "&" + rawQuery
+	}
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+	ip, _, _ := net.SplitHostPort(req.RemoteAddr)
+	// only the values of trusted proxies are passed on, anyone else could spoof them
+	trusted := containsIP(p.trusted, net.ParseIP(ip))
+	if !trusted {
+		req.Header.Del(igin.HeaderXForwardedFor)
+	}
+	if !trusted || req.Header.Get(igin.HeaderXForwardedProto) == "" {
+		req.Header.Set(igin.HeaderXForwardedProto, proto)
+	}
+	if !trusted || req.Header.Get(igin.HeaderXForwardedHost) == "" {
+		req.Header.Set(igin.HeaderXForwardedHost, req.Host)
+	}
+	if (!trusted || req.Header.Get(igin.HeaderXRealIP) == "") && ip != "" {
+		req.Header.Set(igin.HeaderXRealIP, ip)
+	}
+	// X-Forwarded-For is appended by httputil.ReverseProxy
+	req.Host = target.URL.Host
+}
+
+func (p *Proxy) healthCheck() {
+	client := &http.Client{Transport: p.config.Transport, Timeout: p.config.HealthCheckInterval}
+	ticker := time.NewTicker(p.config.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		for _, target := range p.config.Targets {
+			down := int32(1)
+			if resp, err := client.Get(target.URL.Scheme + "://" + target.URL.Host + joinURLPath(target.URL.Path, p.config.HealthCheckPath)); err == nil {
+				resp.Body.Close()
+				if resp.StatusCode < http.StatusInternalServerError {
+					down = 0
+				}
+			}
+			atomic.StoreInt32(&target.unhealthy, down)
+		}
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func joinURLPath(a, b string) string {
+	switch {
+	case a == "" || a == "/":
+		if b == "" {
+			return "/"
+		}
+		return b
+	case b == "" || b == "/":
+		return a
+	}
+	return strings.TrimSuffix(a, "/") + "/" + strings.TrimPrefix(b, "/")
+}
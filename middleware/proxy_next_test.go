@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyNextWithConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Upgrade") == "echo" {
+				conn, rw, _ := w.(http.Hijacker).Hijack()
+				defer conn.Close()
+				_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+				_ = rw.Flush()
+				line, _ := rw.ReadString('\n')
+				_, _ = rw.WriteString(name + ":" + line)
+				_ = rw.Flush()
+				return
+			}
+			w.Header().Set("X-Upstream", name)
+			_, _ = w.Write([]byte(r.URL.RequestURI() + " " + r.Header.Get(igin.HeaderXForwardedHost) + " " + r.Header.Get(igin.HeaderXForwardedProto)))
+		}))
+	}
+	a, b := upstream("a"), upstream("b")
+	defer a.Close()
+	defer b.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	targets := make([]*ProxyTarget, 0, 3)
+	for _, u := range []string{a.URL + "/v1", dead.URL, b.URL + "/v1"} {
+		target, err := NewProxyTarget(u)
+		assert.NoError(t, err)
+		targets = append(targets, target)
+	}
+	g := gin.New()
+	g.Any("/api/*path", ProxyNextWithConfig(ProxyConfig{
+		Targets:  targets,
+		Rewrite:  map[string]string{"/api/*": "/$1"},
+		Retries:  1,
+		MaxFails: 1,
+	}))
+	gateway := httptest.NewServer(g)
+	defer gateway.Close()
+
+	var upstreams []string
+	for i := 0; i < 4; i++ {
+		resp, err := http.Get(gateway.URL + "/api/users?id=1")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body := make([]byte, 128)
+		n, _ := resp.Body.Read(body)
+		resp.Body.Close()
+		assert.Equal(t, "/v1/users?id=1 "+gateway.Listener.Addr().String()+" http", string(body[:n]))
+		upstreams = append(upstreams, resp.Header.Get("X-Upstream"))
+	}
+	assert.Contains(t, upstreams, "a")
+	assert.Contains(t, upstreams, "b", "the dead target is retried on the next one")
+	assert.False(t, targets[1].Healthy())
+
+	resp, err := http.Post(gateway.URL+"/api/users", "text/plain", nil)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	conn, err := net.Dial("tcp", gateway.Listener.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, _ = conn.Write([]byte("GET /api/ws HTTP/1.1\r\nHost: gateway\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+	r := bufio.NewReader(conn)
+	resp, err = http.ReadResponse(r, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	_, _ = conn.Write([]byte("hello\n"))
+	line, _ := r.ReadString('\n')
+	assert.Regexp(t, `^[ab]:hello\n$`, line)
+
+	g2 := gin.New()
+	g2.GET("/", ProxyNextWithConfig(ProxyConfig{Targets: []*ProxyTarget{{URL: targets[1].URL}}}))
+	failing := httptest.NewServer(g2)
+	defer failing.Close()
+	resp, err = http.Get(failing.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+}
+
+func TestProxyForwardedHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range []string{igin.HeaderXForwardedProto, igin.HeaderXForwardedHost, igin.HeaderXRealIP, igin.HeaderXForwardedFor} {
+			_, _ = w.Write([]byte(r.Header.Get(name) + "|"))
+		}
+	}))
+	defer upstream.Close()
+	target, err := NewProxyTarget(upstream.URL)
+	assert.NoError(t, err)
+
+	// both proxies share the target, each keeps its own reverse proxy
+	untrusted, trusted := gin.New(), gin.New()
+	untrusted.GET("/", ProxyNextWithConfig(ProxyConfig{Targets: []*ProxyTarget{target}}))
+	trusted.GET("/", ProxyNextWithConfig(ProxyConfig{Targets: []*ProxyTarget{target}, TrustedProxies: []string{"127.0.0.1"}}))
+	get := func(g *gin.Engine) string {
+		gateway := httptest.NewServer(g)
+		defer gateway.Close()
+		req, _ := http.NewRequest(http.MethodGet, gateway.URL, nil)
+		req.Header.Set(igin.HeaderXForwardedProto, "https")
+		req.Header.Set(igin.HeaderXForwardedHost, "evil.example")
+		req.Header.Set(igin.HeaderXRealIP, "10.0.0.1")
+		req.Header.Set(igin.HeaderXForwardedFor, "10.0.0.1")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body := make([]byte, 256)
+		n, _ := resp.Body.Read(body)
+		return strings.Replace(string(body[:n]), gateway.Listener.Addr().String(), "gateway", 1)
+	}
+
+	assert.Equal(t, "http|gateway|127.0.0.1|127.0.0.1|", get(untrusted), "spoofed headers are replaced")
+	assert.Equal(t, "https|evil.example|10.0.0.1|10.0.0.1, 127.0.0.1|", get(trusted), "trusted proxies pass them on")
+}
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// RedirectToWWW redirects "example.com" to "www.example.com".
+	RedirectToWWW = "www"
+	// RedirectToNonWWW redirects "www.example.com" to "example.com".
+	RedirectToNonWWW = "non-www"
+
+	// TrailingSlashAdd redirects "/users" to "/users/".
+	TrailingSlashAdd = "add"
+	// TrailingSlashRemove redirects "/users/" to "/users".
+	TrailingSlashRemove = "remove"
+)
+
+type (
+	// RedirectConfig defines the config for Redirect middleware.
+	RedirectConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+		// HTTPS redirects plain http requests to https.
+		// Optional. Default value false.
+		HTTPS bool
+		// TrustedProxies are the CIDRs of the proxies allowed to report https through the
+		// `X-Forwarded-Proto` or `X-Forwarded-Ssl` headers.
+		// Optional. Default value none, the headers are trusted from any client.
+		TrustedProxies []string
+		// WWW is RedirectToWWW or RedirectToNonWWW.
+		// Optional. Default value "", the host is kept.
+		WWW string
+		// TrailingSlash is TrailingSlashAdd or TrailingSlashRemove, the root path "/" is never changed.
+		// Optional. Default value "", the path is kept.
+		TrailingSlash string
+		// Code is the status code of redirects of GET and HEAD requests.
+		// Optional. Default value 301.
+		Code int
+		// MethodCode is the status code of redirects of other methods, it should preserve the method and the body.
+		// Optional. Default value 308.
+		MethodCode int
+	}
+)
+
+var (
+	// DefaultRedirectConfig is the default Redirect middleware config.
+	defaultRedirectConfig = RedirectConfig{
+		Skipper:    DefaultSkipper,
+		Code:       http.StatusMovedPermanently,
+		MethodCode: http.StatusPermanentRedirect,
+	}
+)
+
+// HTTPSRedirectNext returns a Redirect middleware redirecting http requests to https.
+func HTTPSRedirectNext() gin.HandlerFunc {
+	c := defaultRedirectConfig
+	c.HTTPS = true
+	return RedirectNextWithConfig(c)
+}
+
+// RedirectNextWithConfig returns a Redirect middleware with config.
+//
+// All changes are combined into a single redirect. Register it with igin.Engine.Pre to redirect
+// requests of paths without route, e.g. a missing trailing slash.
+func RedirectNextWithConfig(config RedirectConfig) gin.HandlerFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = defaultRedirectConfig.Skipper
+	}
+	if config.Code == 0 {
+		config.Code = defaultRedirectConfig.Code
+	}
+	if config.MethodCode == 0 {
+		config.MethodCode = defaultRedirectConfig.MethodCode
+	}
+	switch config.WWW {
+	case "", RedirectToWWW, RedirectToNonWWW:
+	default:
+		panic("IGin: unknown www redirect " + config.WWW)
+	}
+	switch config.TrailingSlash {
+	case "", TrailingSlashAdd, TrailingSlashRemove:
+	default:
+		panic("IGin: unknown trailing slash redirect " + config.TrailingSlash)
+	}
+	var trustedProxies []*net.IPNet
+	if len(config.TrustedProxies) > 0 {
+		var err error
+		if trustedProxies, err = ParseCIDRs(config.TrustedProxies); err != nil {
+			panic(err)
+		}
+	}
+	return func(c *gin.Context) {
+		if config.Skipper(c) {
+			return
+		}
+		https := secureIsHTTPS(c, trustedProxies)
+		scheme, host, path := "http", c.Request.Host, c.Request.URL.Path
+		if https || config.HTTPS {
+			scheme = "https"
+		}
+		switch config.WWW {
+		case RedirectToWWW:
+			if !strings.HasPrefix(host, "www.") {
+				host = "www." + host
+			}
+		case RedirectToNonWWW:
+			host = strings.TrimPrefix(host, "www.")
+		}
+		switch config.TrailingSlash {
+		case TrailingSlashAdd:
+			if !strings.HasSuffix(path, "/") {
+				path += "/"
+			}
+		case TrailingSlashRemove:
+			if len(path) > 1 {
+				path = strings.TrimRight(path, "/")
+				if path == "" {
+					path = "/"
+				}
+			}
+		}
+		if https == (scheme == "https") && host == c.Request.Host && path == c.Request.URL.Path {
+			return
+		}
+		target := &url.URL{Scheme: scheme, Host: host, Path: path, RawQuery: c.Request.URL.RawQuery}
+		code := config.Code
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			code = config.MethodCode
+		}
+		c.Redirect(code, target.String())
+		c.Abort()
+	}
+}
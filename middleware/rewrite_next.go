@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	// RewriteConfig defines the config for Rewrite middleware.
+	RewriteConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+		// Rules are tried in order, the first matching rule rewrites the path.
+		// Required.
+		Rules []RewriteRule
+	}
+
+	// RewriteRule rewrites paths matching Pattern or Regexp to Replacement.
+	RewriteRule struct {
+		// Pattern matches the whole path, every "*" captures a group, e.g. "/v1/users/*".
+		Pattern string
+		// Regexp is used instead of Pattern when set, e.g. regexp.MustCompile(`^/users/(\d+)$`).
+		Regexp *regexp.Regexp
+		// Replacement is the new path, $1, $2... reference the captured groups, e.g. "/api/users/$1".
+		// A query in the replacement, e.g. "/search?type=$1", is added before the query of the request.
+		Replacement string
+	}
+)
+
+// RewriteNext returns a Rewrite middleware for wildcard rules like "/old/*": "/new/$1",
+// longer patterns are tried first.
+//
+// Register it with igin.Engine.Pre so the rewritten path is routed.
+func RewriteNext(rules map[string]string) gin.HandlerFunc {
+	config := RewriteConfig{}
+	for _, rule := range compileRewrites(rules) {
+		config.Rules = append(config.Rules, RewriteRule{Regexp: rule.pattern, Replacement: rule.replacement})
+	}
+	return RewriteNextWithConfig(config)
+}
+
+// RewriteNextWithConfig returns a Rewrite middleware with config.
+//
+// Register it with igin.Engine.Pre so the rewritten path is routed, as a regular middleware it only
+// changes c.Request.URL for the handlers of the route already matched.
+func RewriteNextWithConfig(config RewriteConfig) gin.HandlerFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultSkipper
+	}
+	if len(config.Rules) == 0 {
+		panic("IGin: rewrite middleware requires rules")
+	}
+	rules := make([]rewriteRule, 0, len(config.Rules))
+	for _, rule := range config.Rules {
+		pattern := rule.Regexp
+		if pattern == nil {
+			if rule.Pattern == "" {
+				panic("IGin: rewrite rule requires a pattern or a regexp")
+			}
+			pattern = wildcardRegexp(rule.Pattern)
+		}
+		rules = append(rules, compileRewrite(pattern, rule.Replacement))
+	}
+	return func(c *gin.Context) {
+		if !config.Skipper(c) {
+			rewriteURL(rules, c.Request.URL)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteNextWithConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := igin.New()
+	e.Pre(RewriteNextWithConfig(RewriteConfig{Rules: []RewriteRule{
+		{Regexp: regexp.MustCompile(`^/users/(\d+)$`), Replacement: "/api/users/$1"},
+		{Pattern: "/users/*", Replacement: "/api/search?name=$1"},
+		{Pattern: "/v1/*", Replacement: "/api/$1"},
+	}}))
+	e.GET("/api/users/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, "user "+c.Param("id"))
+	})
+	e.GET("/api/search", func(c *gin.Context) {
+		c.String(http.StatusOK, "search "+c.Request.URL.RawQuery)
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	assert.Equal(t, "user 7", get("/users/7").Body.String())
+	assert.Equal(t, "search name=bob&page=2", get("/users/bob?page=2").Body.String(), "rules are tried in order")
+	assert.Equal(t, "user 8", get("/v1/users/8").Body.String())
+	assert.Equal(t, "user 9", get("/api/users/9").Body.String())
+	assert.Equal(t, http.StatusNotFound, get("/other").Code)
+}
+
+func TestRedirectNextWithConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := igin.New()
+	e.RedirectTrailingSlash = false
+	e.Pre(RedirectNextWithConfig(RedirectConfig{
+		HTTPS:         true,
+		WWW:           RedirectToNonWWW,
+		TrailingSlash: TrailingSlashRemove,
+	}))
+	e.Any("/users", func(c *gin.Context) {
+		c.String(http.StatusOK, "users")
+	})
+
+	serve := func(method, target string, headers ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(http.MethodGet, "http://www.example.com/users/?page=2")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "https://example.com/users?page=2", w.Header().Get(igin.HeaderLocation))
+
+	w = serve(http.MethodPost, "http://example.com/users")
+	assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+	assert.Equal(t, "https://example.com/users", w.Header().Get(igin.HeaderLocation))
+
+	w = serve(http.MethodGet, "http://example.com/users", igin.HeaderXForwardedProto, "https")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "users", w.Body.String())
+
+	w = serve(http.MethodGet, "https://example.com/")
+	assert.Equal(t, http.StatusNotFound, w.Code, "the root path is kept")
+}
@@ -2,6 +2,8 @@ package middleware
 
 import (
 	"fmt"
+	"net"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pkg6/igin"
@@ -52,6 +54,12 @@ type SecureConfig struct {
 	// Optional. Default value "".
 	ContentSecurityPolicy string
 
+	// CSP builds the `Content-Security-Policy` header and takes precedence over ContentSecurityPolicy.
+	// When it contains CSPNonce a nonce is generated per request and stored into context,
+	// see ContextCSPNonce and CSPFuncMap.
+	// Optional. Default value nil.
+	CSP *CSP
+
 	// CSPReportOnly would use the `Content-Security-Policy-Report-Only` header instead
 	// of the `Content-Security-Policy` header. This allows iterative updates of the
 	// content security policy by only reporting the violations that would
@@ -69,8 +77,49 @@ type SecureConfig struct {
 	// leaking potentially sensitive request paths to third parties.
 	// Optional. Default value "".
 	ReferrerPolicy string
+
+	// TrustedProxies are the CIDRs of the proxies allowed to report https through the
+	// `X-Forwarded-Proto` or `X-Forwarded-Ssl` headers. HSTS is always sent for direct TLS connections.
+	// Optional. Default value none, the headers are trusted from any client.
+	TrustedProxies []string
+
+	// PermissionsPolicy sets the `Permissions-Policy` header controlling which browser
+	// features the page may use, e.g. "camera=(), microphone=(), geolocation=()".
+	// Optional. Default value "".
+	PermissionsPolicy string
+
+	// CrossOriginOpenerPolicy sets the `Cross-Origin-Opener-Policy` header isolating the
+	// browsing context from cross-origin windows.
+	// Optional. Default value "".
+	// Possible values: "unsafe-none", "same-origin-allow-popups", "same-origin".
+	CrossOriginOpenerPolicy string
+
+	// CrossOriginEmbedderPolicy sets the `Cross-Origin-Embedder-Policy` header preventing the
+	// page from loading cross-origin resources without explicit permission.
+	// Optional. Default value "".
+	// Possible values: "unsafe-none", "require-corp", "credentialless".
+	CrossOriginEmbedderPolicy string
+
+	// CrossOriginResourcePolicy sets the `Cross-Origin-Resource-Policy` header restricting
+	// which origins may load the response.
+	// Optional. Default value "".
+	// Possible values: "same-site", "same-origin", "cross-origin".
+	CrossOriginResourcePolicy string
+
+	// XPermittedCrossDomainPolicies sets the `X-Permitted-Cross-Domain-Policies` header
+	// restricting Adobe Flash and PDF clients loading data from the domain.
+	// Optional. Default value "".
+	// Possible values: "none", "master-only", "by-content-type", "all".
+	XPermittedCrossDomainPolicies string
 }
 
+const (
+	// SecurePresetStrictAPI locks down responses of JSON APIs which are never rendered by browsers.
+	SecurePresetStrictAPI = "strict-api"
+	// SecurePresetWebApp suits server rendered web applications using nonce based scripts.
+	SecurePresetWebApp = "web-app"
+)
+
 var defaultSecureConfig = SecureConfig{
 	Skipper:            DefaultSkipper,
 	XSSProtection:      "1; mode=block",
@@ -83,7 +132,64 @@ func SecureNext() gin.HandlerFunc {
 	return SecureNextWithConfig(defaultSecureConfig)
 }
 
+// SecureNextWithPreset returns a Secure middleware with the named preset, see SecurePreset.
+func SecureNextWithPreset(name string) gin.HandlerFunc {
+	return SecureNextWithConfig(SecurePreset(name))
+}
+
+// SecurePreset returns the config of a named preset, it can be adjusted before use.
+// Possible names: SecurePresetStrictAPI, SecurePresetWebApp.
+func SecurePreset(name string) SecureConfig {
+	config := SecureConfig{
+		Skipper:                       DefaultSkipper,
+		XSSProtection:                 "0",
+		ContentTypeNosniff:            "nosniff",
+		HSTSMaxAge:                    31536000,
+		CrossOriginOpenerPolicy:       "same-origin",
+		CrossOriginResourcePolicy:     "same-origin",
+		XPermittedCrossDomainPolicies: "none",
+	}
+	switch name {
+	case SecurePresetStrictAPI:
+		config.XFrameOptions = "DENY"
+		config.ContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+		config.ReferrerPolicy = "no-referrer"
+		config.PermissionsPolicy = "camera=(), microphone=(), geolocation=(), payment=(), usb=()"
+	case SecurePresetWebApp:
+		config.XFrameOptions = "SAMEORIGIN"
+		config.CSP = NewCSP().DefaultSrc(CSPSelf).ScriptSrc(CSPNonce, CSPStrictDynamic).ObjectSrc(CSPNone).
+			BaseURI(CSPSelf).FrameAncestors(CSPSelf)
+		config.ReferrerPolicy = "strict-origin-when-cross-origin"
+		config.PermissionsPolicy = "camera=(), microphone=(), geolocation=()"
+	default:
+		panic("IGin: unknown secure preset " + name)
+	}
+	return config
+}
+
 func SecureNextWithConfig(config SecureConfig) gin.HandlerFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = defaultSecureConfig.Skipper
+	}
+	cspHeader := igin.HeaderContentSecurityPolicy
+	if config.CSPReportOnly {
+		cspHeader = igin.HeaderContentSecurityPolicyReportOnly
+	}
+	var trustedProxies []*net.IPNet
+	if len(config.TrustedProxies) > 0 {
+		var err error
+		if trustedProxies, err = ParseCIDRs(config.TrustedProxies); err != nil {
+			panic(err)
+		}
+	}
+	var policy, reportingEndpoints string
+	nonce := false
+	if config.CSP != nil {
+		policy = config.CSP.String()
+		reportingEndpoints = config.CSP.ReportingEndpoints()
+		nonce = config.CSP.UsesNonce()
+	}
 	return func(c *gin.Context) {
 		if config.Skipper(c) {
 			c.Next()
@@ -98,7 +204,7 @@ func SecureNextWithConfig(config SecureConfig) gin.HandlerFunc {
 		if config.XFrameOptions != "" {
 			c.Header(igin.HeaderXFrameOptions, config.XFrameOptions)
 		}
-		if (c.Request.Header.Get(igin.HeaderXForwardedProto) == "https") && config.HSTSMaxAge != 0 {
+		if config.HSTSMaxAge != 0 && secureIsHTTPS(c, trustedProxies) {
 			subdomains := ""
 			if !config.HSTSExcludeSubdomains {
 				subdomains = "; includeSubdomains"
@@ -108,16 +214,50 @@ func SecureNextWithConfig(config SecureConfig) gin.HandlerFunc {
 			}
 			c.Header(igin.HeaderStrictTransportSecurity, fmt.Sprintf("max-age=%d%s", config.HSTSMaxAge, subdomains))
 		}
-		if config.ContentSecurityPolicy != "" {
-			if config.CSPReportOnly {
-				c.Header(igin.HeaderContentSecurityPolicyReportOnly, config.ContentSecurityPolicy)
+		if config.CSP != nil {
+			if nonce {
+				value := newCSPNonce()
+				c.Set(CSPNonceContextKey, value)
+				c.Header(cspHeader, config.CSP.Build(value))
 			} else {
-				c.Header(igin.HeaderContentSecurityPolicy, config.ContentSecurityPolicy)
+				c.Header(cspHeader, policy)
 			}
+			if reportingEndpoints != "" {
+				c.Header(igin.HeaderReportingEndpoints, reportingEndpoints)
+			}
+		} else if config.ContentSecurityPolicy != "" {
+			c.Header(cspHeader, config.ContentSecurityPolicy)
 		}
 		if config.ReferrerPolicy != "" {
 			c.Header(igin.HeaderReferrerPolicy, config.ReferrerPolicy)
 		}
+		if config.PermissionsPolicy != "" {
+			c.Header(igin.HeaderPermissionsPolicy, config.PermissionsPolicy)
+		}
+		if config.CrossOriginOpenerPolicy != "" {
+			c.Header(igin.HeaderCrossOriginOpenerPolicy, config.CrossOriginOpenerPolicy)
+		}
+		if config.CrossOriginEmbedderPolicy != "" {
+			c.Header(igin.HeaderCrossOriginEmbedderPolicy, config.CrossOriginEmbedderPolicy)
+		}
+		if config.CrossOriginResourcePolicy != "" {
+			c.Header(igin.HeaderCrossOriginResourcePolicy, config.CrossOriginResourcePolicy)
+		}
+		if config.XPermittedCrossDomainPolicies != "" {
+			c.Header(igin.HeaderXPermittedCrossDomainPolicies, config.XPermittedCrossDomainPolicies)
+		}
 		c.Next()
 	}
 }
+
+// secureIsHTTPS reports whether the request was made over TLS, directly or through a trusted proxy.
+func secureIsHTTPS(c *gin.Context, trustedProxies []*net.IPNet) bool {
+	if c.Request.TLS != nil {
+		return true
+	}
+	if trustedProxies != nil && !containsIP(trustedProxies, net.ParseIP(c.RemoteIP())) {
+		return false
+	}
+	return strings.EqualFold(c.Request.Header.Get(igin.HeaderXForwardedProto), "https") ||
+		strings.EqualFold(c.Request.Header.Get(igin.HeaderXForwardedSsl), "on")
+}
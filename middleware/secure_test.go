@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecureNextHSTS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.Use(SecureNextWithConfig(SecureConfig{HSTSMaxAge: 3600, TrustedProxies: []string{"10.0.0.1"}}))
+	g.GET("/", func(c *gin.Context) {})
+	cases := []struct {
+		remoteAddr string
+		tls        bool
+		proto      string
+		hsts       bool
+	}{
+		{remoteAddr: "192.0.2.1:1234", tls: true, hsts: true},
+		{remoteAddr: "10.0.0.1:1234", proto: "https", hsts: true},
+		{remoteAddr: "192.0.2.1:1234", proto: "https"},
+		{remoteAddr: "10.0.0.1:1234"},
+	}
+	for _, each := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = each.remoteAddr
+		if each.tls {
+			req.TLS = &tls.ConnectionState{}
+		}
+		if each.proto != "" {
+			req.Header.Set(igin.HeaderXForwardedProto, each.proto)
+		}
+		g.ServeHTTP(w, req)
+		if each.hsts {
+			assert.Equal(t, "max-age=3600; includeSubdomains", w.Header().Get(igin.HeaderStrictTransportSecurity))
+		} else {
+			assert.Empty(t, w.Header().Get(igin.HeaderStrictTransportSecurity))
+		}
+	}
+}
+
+func TestSecureNextWithPreset(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.Use(SecureNextWithPreset(SecurePresetStrictAPI))
+	g.GET("/", func(c *gin.Context) {})
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "DENY", w.Header().Get(igin.HeaderXFrameOptions))
+	assert.Equal(t, "default-src 'none'; frame-ancestors 'none'", w.Header().Get(igin.HeaderContentSecurityPolicy))
+	assert.Equal(t, "same-origin", w.Header().Get(igin.HeaderCrossOriginOpenerPolicy))
+	assert.Equal(t, "same-origin", w.Header().Get(igin.HeaderCrossOriginResourcePolicy))
+	assert.Equal(t, "none", w.Header().Get(igin.HeaderXPermittedCrossDomainPolicies))
+	assert.NotEmpty(t, w.Header().Get(igin.HeaderPermissionsPolicy))
+
+	assert.NotNil(t, SecurePreset(SecurePresetWebApp).CSP)
+	assert.Panics(t, func() { SecurePreset("unknown") })
+}
@@ -0,0 +1,103 @@
+package session
+
+import (
+	"encoding/gob"
+	"html/template"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+)
+
+const (
+	FlashSuccess = "success"
+	FlashError   = "error"
+	FlashInfo    = "info"
+
+	flashValueKey = "_flashes"
+)
+
+// Flash is a one-shot message shown on the next rendered page.
+type Flash struct {
+	Category string
+	Message  string
+}
+
+var (
+	// FlashSessionName is the name of the session flashes are stored in.
+	FlashSessionName = "_flash"
+)
+
+func init() {
+	gob.Register([]Flash{})
+}
+
+// AddFlash adds a message of category to the flashes and saves the session.
+func AddFlash(c *gin.Context, category, message string) error {
+	session, err := Session(c, FlashSessionName)
+	if err != nil {
+		return err
+	}
+	flashes, _ := session.Values[flashValueKey].([]Flash)
+	session.Values[flashValueKey] = append(flashes, Flash{Category: category, Message: message})
+	return session.Save(c.Request, c.Writer)
+}
+
+// Flashes returns and consumes the flashes of the given categories, all of them when no category is given.
+// Flashes of other categories are kept for a later read.
+func Flashes(c *gin.Context, categories ...string) []Flash {
+	session, err := Session(c, FlashSessionName)
+	if err != nil {
+		return nil
+	}
+	flashes, _ := session.Values[flashValueKey].([]Flash)
+	if len(flashes) == 0 {
+		return nil
+	}
+	var read, kept []Flash
+	for _, flash := range flashes {
+		if flashMatches(flash, categories) {
+			read = append(read, flash)
+		} else {
+			kept = append(kept, flash)
+		}
+	}
+	if len(read) == 0 {
+		return nil
+	}
+	if len(kept) == 0 {
+		delete(session.Values, flashValueKey)
+	} else {
+		session.Values[flashValueKey] = kept
+	}
+	if err := session.Save(c.Request, c.Writer); err != nil {
+		_ = c.Error(err)
+	}
+	return read
+}
+
+// FlashFuncMap returns the "flashes" template function, register it with igin.Engine.SetFuncMaps.
+//
+//	{{ range flashes "error" }}<p class="{{ .Category }}">{{ .Message }}</p>{{ end }}
+//
+// The flashes are consumed, so templates must be rendered before the response body is written.
+func FlashFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"flashes": igin.ContextFunc(func(c *gin.Context) any {
+			return func(categories ...string) []Flash {
+				return Flashes(c, categories...)
+			}
+		}),
+	}
+}
+
+func flashMatches(flash Flash, categories []string) bool {
+	if len(categories) == 0 {
+		return true
+	}
+	for _, category := range categories {
+		if flash.Category == category {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package session
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// Regenerate moves the named session to a new id and restarts its absolute timeout.
+// Call it after login or privilege changes to prevent session fixation.
+// The values are kept, the data stored under the old id is deleted for server side stores.
+func Regenerate(c *gin.Context, name string) error {
+	session, err := Session(c, name)
+	if err != nil {
+		return err
+	}
+	if err := discard(session); err != nil {
+		return err
+	}
+	delete(session.Values, csrfValueKey)
+	now := time.Now().Unix()
+	session.Values[createdValueKey] = now
+	session.Values[lastAccessValueKey] = now
+	return session.Save(c.Request, c.Writer)
+}
+
+// GetValue returns the value stored under key in the named session.
+// It returns false when the session can not be loaded, the key is missing or the value is not a T.
+func GetValue[T any](c *gin.Context, name string, key any) (T, bool) {
+	var zero T
+	session, err := Session(c, name)
+	if err != nil {
+		return zero, false
+	}
+	value, ok := session.Values[key].(T)
+	if !ok {
+		return zero, false
+	}
+	return value, true
+}
+
+// SetValue stores value under key in the named session and saves it.
+// Values of custom types must be registered with gob.Register for cookie and server side stores.
+func SetValue(c *gin.Context, name string, key, value any) error {
+	session, err := Session(c, name)
+	if err != nil {
+		return err
+	}
+	session.Values[key] = value
+	return session.Save(c.Request, c.Writer)
+}
+
+// DeleteValue removes key from the named session and saves it.
+func DeleteValue(c *gin.Context, name string, key any) error {
+	session, err := Session(c, name)
+	if err != nil {
+		return err
+	}
+	delete(session.Values, key)
+	return session.Save(c.Request, c.Writer)
+}
+
+// touch enforces the timeouts of config and records the access, it is called once per request and session.
+// An expired session is replaced by an empty one with a new id. New sessions without values are not saved,
+// anonymous requests get no cookie nor backend entry.
+func touch(c *gin.Context, config *SessionConfig, session *sessions.Session) error {
+	if config.IdleTimeout <= 0 && config.AbsoluteTimeout <= 0 {
+		return nil
+	}
+	now := time.Now().Unix()
+	created, _ := session.Values[createdValueKey].(int64)
+	lastAccess, _ := session.Values[lastAccessValueKey].(int64)
+	expired := (config.AbsoluteTimeout > 0 && created > 0 && time.Duration(now-created)*time.Second >= config.AbsoluteTimeout) ||
+		(config.IdleTimeout > 0 && lastAccess > 0 && time.Duration(now-lastAccess)*time.Second >= config.IdleTimeout)
+	if expired {
+		if err := discard(session); err != nil {
+			return err
+		}
+		session.Values = map[interface{}]interface{}{}
+		session.IsNew = true
+	}
+	if created == 0 || expired {
+		session.Values[createdValueKey] = now
+	}
+	session.Values[lastAccessValueKey] = now
+	if session.IsNew && !expired && !hasUserValues(session) {
+		return nil
+	}
+	return session.Save(c.Request, c.Writer)
+}
+
+// hasUserValues reports whether session holds values besides the timestamps of touch.
+func hasUserValues(session *sessions.Session) bool {
+	for key := range session.Values {
+		if key != createdValueKey && key != lastAccessValueKey {
+			return true
+		}
+	}
+	return false
+}
+
+// discard drops the current id of session so the next save issues a new one.
+func discard(session *sessions.Session) error {
+	if store, ok := session.Store().(*ServerStore); ok && session.ID != "" {
+		if err := store.Backend.Delete(session.ID); err != nil {
+			return err
+		}
+	}
+	session.ID = ""
+	return nil
+}
+
+// CSRFBinding returns a middleware.CSRFConfig SessionBinding binding csrf tokens to the named session.
+// Server side sessions are bound by id, cookie sessions by a random value stored in the session,
+// both change on Regenerate so tokens issued before login are not accepted afterwards.
+func CSRFBinding(name string) func(c *gin.Context) string {
+	return func(c *gin.Context) string {
+		session, err := Session(c, name)
+		if err != nil {
+			return ""
+		}
+		if _, ok := session.Store().(*ServerStore); ok {
+			if session.ID == "" {
+				// issue the id now, the token is bound to it
+				if err := session.Save(c.Request, c.Writer); err != nil {
+					return ""
+				}
+			}
+			return session.ID
+		}
+		binding, _ := session.Values[csrfValueKey].(string)
+		if binding == "" {
+			binding = sessionIDEncoding.EncodeToString(securecookie.GenerateRandomKey(16))
+			session.Values[csrfValueKey] = binding
+			if err := session.Save(c.Request, c.Writer); err != nil {
+				return ""
+			}
+		}
+		return binding
+	}
+}
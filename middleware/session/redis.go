@@ -0,0 +1,234 @@
+package session
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+type (
+	// RedisOptions defines the connection options of RedisBackend.
+	RedisOptions struct {
+		// Addr of the redis server.
+		// Optional. Default value "127.0.0.1:6379".
+		Addr string
+		// Password sent with AUTH when not empty.
+		Password string
+		// DB selected after connecting.
+		DB int
+		// Prefix of the keys the sessions are stored under.
+		// Optional. Default value "session_".
+		Prefix string
+		// PoolSize is the maximum number of idle connections kept.
+		// Optional. Default value 10.
+		PoolSize int
+		// DialTimeout is used for connecting and every command.
+		// Optional. Default value 5 seconds.
+		DialTimeout time.Duration
+	}
+
+	// RedisBackend is a Backend storing sessions in redis or any server speaking the redis protocol.
+	RedisBackend struct {
+		options RedisOptions
+		pool    chan *redisConn
+	}
+
+	redisConn struct {
+		conn net.Conn
+		r    *bufio.Reader
+	}
+
+	// RedisError is an error reply of the redis server.
+	RedisError string
+)
+
+var defaultRedisOptions = RedisOptions{
+	Addr:        "127.0.0.1:6379",
+	Prefix:      fileSessionPrefix,
+	PoolSize:    10,
+	DialTimeout: 5 * time.Second,
+}
+
+// NewRedisStore returns a ServerStore keeping values in redis.
+func NewRedisStore(options RedisOptions, keyPairs ...[]byte) *ServerStore {
+	return NewServerStore(NewRedisBackend(options), keyPairs...)
+}
+
+// NewRedisBackend returns a RedisBackend, connections are opened lazily.
+func NewRedisBackend(options RedisOptions) *RedisBackend {
+	if options.Addr == "" {
+		options.Addr = defaultRedisOptions.Addr
+	}
+	if options.Prefix == "" {
+		options.Prefix = defaultRedisOptions.Prefix
+	}
+	if options.PoolSize <= 0 {
+		options.PoolSize = defaultRedisOptions.PoolSize
+	}
+	if options.DialTimeout <= 0 {
+		options.DialTimeout = defaultRedisOptions.DialTimeout
+	}
+	return &RedisBackend{options: options, pool: make(chan *redisConn, options.PoolSize)}
+}
+
+func (e RedisError) Error() string {
+	return "redis: " + string(e)
+}
+
+func (b *RedisBackend) Load(id string) ([]byte, error) {
+	reply, err := b.do("GET", b.options.Prefix+id)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected GET reply %T", reply)
+	}
+	return data, nil
+}
+
+func (b *RedisBackend) Save(id string, data []byte, ttl time.Duration) error {
+	args := []string{"SET", b.options.Prefix + id, string(data)}
+	if ttl > 0 {
+		seconds := int64(ttl / time.Second)
+		if seconds < 1 {
+			seconds = 1
+		}
+		args = append(args, "EX", strconv.FormatInt(seconds, 10))
+	}
+	_, err := b.do(args...)
+	return err
+}
+
+func (b *RedisBackend) Delete(id string) error {
+	_, err := b.do("DEL", b.options.Prefix+id)
+	return err
+}
+
+// Close closes the idle connections.
+func (b *RedisBackend) Close() error {
+	for {
+		select {
+		case rc := <-b.pool:
+			_ = rc.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (b *RedisBackend) do(args ...string) (any, error) {
+	rc, err := b.get()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := rc.do(b.options.DialTimeout, args...)
+	var redisErr RedisError
+	if err != nil && !errors.As(err, &redisErr) {
+		_ = rc.conn.Close()
+		return nil, err
+	}
+	b.put(rc)
+	return reply, err
+}
+
+func (b *RedisBackend) get() (*redisConn, error) {
+	select {
+	case rc := <-b.pool:
+		return rc, nil
+	default:
+	}
+	conn, err := net.DialTimeout("tcp", b.options.Addr, b.options.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	rc := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+	if b.options.Password != "" {
+		if _, err := rc.do(b.options.DialTimeout, "AUTH", b.options.Password); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	if b.options.DB != 0 {
+		if _, err := rc.do(b.options.DialTimeout, "SELECT", strconv.Itoa(b.options.DB)); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+func (b *RedisBackend) put(rc *redisConn) {
+	select {
+	case b.pool <- rc:
+	default:
+		_ = rc.conn.Close()
+	}
+}
+
+// do writes a command as RESP array of bulk strings and reads the reply.
+func (rc *redisConn) do(timeout time.Duration, args ...string) (any, error) {
+	_ = rc.conn.SetDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	if _, err := rc.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return readRESP(rc.r)
+}
+
+// readRESP reads a single reply, bulk strings are returned as []byte and nil bulk strings as nil.
+func readRESP(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: malformed reply")
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, RedisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readRESP(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", line[0])
+}
@@ -2,15 +2,21 @@ package session
 
 import (
 	"fmt"
-	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 	"github.com/pkg6/igin/middleware"
 )
 
 const (
-	sessionContextKey = "_session_store"
+	sessionContextKey  = "_session_store"
+	sessionConfigKey   = "_session_config"
+	sessionCheckedKey  = "_session_checked_"
+	createdValueKey    = "_created"
+	lastAccessValueKey = "_last_access"
+	csrfValueKey       = "_csrf"
 )
 
 type (
@@ -21,16 +27,22 @@ type (
 		// Session store.
 		// Required.
 		Store sessions.Store
+		// IdleTimeout expires sessions not accessed for the given duration.
+		// Optional. Default value 0, no idle timeout.
+		IdleTimeout time.Duration
+		// AbsoluteTimeout expires sessions the given duration after they were created, regardless of activity.
+		// Optional. Default value 0, no absolute timeout.
+		AbsoluteTimeout time.Duration
 	}
 	Value map[interface{}]interface{}
 )
 
 var (
-	hostname, _ = os.Hostname()
 	// DefaultConfig is the default Session middleware config.
+	// The random key does not survive restarts and is not shared between instances.
 	defaultConfig = SessionConfig{
 		Skipper: middleware.DefaultSkipper,
-		Store:   sessions.NewCookieStore([]byte("https://github.com/pkg6/igin@" + hostname)),
+		Store:   sessions.NewCookieStore(securecookie.GenerateRandomKey(32)),
 	}
 )
 
@@ -43,7 +55,17 @@ func Set(c *gin.Context, key string, value Value, options ...*sessions.Options)
 	if len(options) > 0 {
 		session.Options = options[0]
 	}
-	session.Values = value
+	values := make(Value, len(value)+2)
+	for k, v := range value {
+		values[k] = v
+	}
+	// keep the lifecycle timestamps
+	for _, k := range []string{createdValueKey, lastAccessValueKey, csrfValueKey} {
+		if v, ok := session.Values[k]; ok {
+			values[k] = v
+		}
+	}
+	session.Values = values
 	return session.Save(c.Request, c.Writer)
 }
 
@@ -68,15 +90,30 @@ func Get(c *gin.Context, key string) (Value, error) {
 
 // Session Get returns a named session.
 func Session(c *gin.Context, name string) (*sessions.Session, error) {
-	session, exists := c.Get(sessionContextKey)
+	store, exists := c.Get(sessionContextKey)
 	if !exists {
 		return nil, fmt.Errorf("%q session store not found", sessionContextKey)
 	}
-	return session.(sessions.Store).Get(c.Request, name)
+	session, err := store.(sessions.Store).Get(c.Request, name)
+	if err != nil {
+		return session, err
+	}
+	value, _ := c.Get(sessionConfigKey)
+	if config, ok := value.(*SessionConfig); ok && !c.GetBool(sessionCheckedKey+name) {
+		c.Set(sessionCheckedKey+name, true)
+		if err := touch(c, config, session); err != nil {
+			return session, err
+		}
+	}
+	return session, nil
 }
 
 // Next returns a Session middleware.
+//
+// The default cookie store is keyed by a random key generated at startup, so sessions are lost on restart.
+// Use NextWithStore with your own keys in production.
 func Next() gin.HandlerFunc {
+	_, _ = fmt.Fprintln(gin.DefaultErrorWriter, "[IGIN-WARNING] session middleware is using a random key generated at startup, sessions do not survive restarts. Use session.NextWithStore with your own keys.")
 	return NextWithConfig(defaultConfig)
 }
 
@@ -102,6 +139,9 @@ func NextWithConfig(config SessionConfig) gin.HandlerFunc {
 			return
 		}
 		c.Set(sessionContextKey, config.Store)
+		if config.IdleTimeout > 0 || config.AbsoluteTimeout > 0 {
+			c.Set(sessionConfigKey, &config)
+		}
 		c.Next()
 	}
 }
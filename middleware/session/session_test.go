@@ -0,0 +1,209 @@
+package session
+
+import (
+	"bufio"
+	"html/template"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+	"github.com/pkg6/igin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSessionEngine(config SessionConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(NextWithConfig(config))
+	r.GET("/set", func(c *gin.Context) {
+		_ = SetValue(c, "s", "user", c.Query("user"))
+	})
+	r.GET("/get", func(c *gin.Context) {
+		user, _ := GetValue[string](c, "s", "user")
+		c.String(http.StatusOK, user)
+	})
+	r.GET("/login", func(c *gin.Context) {
+		_ = Regenerate(c, "s")
+	})
+	r.GET("/idle", func(c *gin.Context) {
+		_ = SetValue(c, "s", lastAccessValueKey, time.Now().Add(-time.Hour).Unix())
+	})
+	return r
+}
+
+func request(r http.Handler, path string, cookie *http.Cookie) (*httptest.ResponseRecorder, *http.Cookie) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	r.ServeHTTP(w, req)
+	for _, c := range w.Result().Cookies() {
+		cookie = c
+	}
+	return w, cookie
+}
+
+func testServerStore(t *testing.T, store *ServerStore) {
+	r := newSessionEngine(SessionConfig{Store: store, IdleTimeout: time.Minute})
+	_, cookie := request(r, "/set?user=igin", nil)
+	assert.NotNil(t, cookie)
+	assert.Less(t, len(cookie.Value), 200, "the cookie only carries the id")
+	w, cookie := request(r, "/get", cookie)
+	assert.Equal(t, "igin", w.Body.String())
+
+	_, regenerated := request(r, "/login", cookie)
+	assert.NotEqual(t, cookie.Value, regenerated.Value)
+	w, _ = request(r, "/get", cookie)
+	assert.Equal(t, "", w.Body.String(), "the old id is no longer valid")
+	w, cookie = request(r, "/get", regenerated)
+	assert.Equal(t, "igin", w.Body.String())
+
+	_, cookie = request(r, "/idle", cookie)
+	w, _ = request(r, "/get", cookie)
+	assert.Equal(t, "", w.Body.String(), "idle sessions expire")
+}
+
+func TestMemoryStore(t *testing.T) {
+	testServerStore(t, NewMemoryStore([]byte("secret")))
+}
+
+func TestFilesystemStore(t *testing.T) {
+	testServerStore(t, NewFilesystemStore(t.TempDir(), []byte("secret")))
+}
+
+func TestRedisStore(t *testing.T) {
+	addr := redisStandIn(t)
+	store := NewRedisStore(RedisOptions{Addr: addr, Password: "pass"}, []byte("secret"))
+	testServerStore(t, store)
+	assert.NoError(t, store.Backend.(*RedisBackend).Close())
+
+	backend := NewRedisBackend(RedisOptions{Addr: addr, Password: "wrong"})
+	_, err := backend.Load("id")
+	assert.EqualError(t, err, "redis: ERR invalid password")
+}
+
+func TestMemoryBackendTTL(t *testing.T) {
+	backend := NewMemoryBackend()
+	assert.NoError(t, backend.Save("a", []byte("a"), time.Nanosecond))
+	time.Sleep(time.Millisecond)
+	data, err := backend.Load("a")
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+	assert.Equal(t, 0, backend.Len())
+}
+
+func TestAbsoluteTimeout(t *testing.T) {
+	r := newSessionEngine(SessionConfig{Store: sessions.NewCookieStore([]byte("secret")), AbsoluteTimeout: time.Hour})
+	r.GET("/old", func(c *gin.Context) {
+		_ = SetValue(c, "s", createdValueKey, time.Now().Add(-2*time.Hour).Unix())
+	})
+	_, cookie := request(r, "/set?user=igin", nil)
+	_, cookie = request(r, "/old", cookie)
+	w, _ := request(r, "/get", cookie)
+	assert.Equal(t, "", w.Body.String())
+}
+
+func TestAnonymousSession(t *testing.T) {
+	store := NewMemoryStore([]byte("secret"))
+	r := newSessionEngine(SessionConfig{Store: store, IdleTimeout: time.Minute})
+	w, cookie := request(r, "/get", nil)
+	assert.Nil(t, cookie, "sessions without values are not saved")
+	assert.Empty(t, w.Header().Get("Set-Cookie"))
+	assert.Equal(t, 0, store.Backend.(*MemoryBackend).Len())
+
+	_, cookie = request(r, "/set?user=igin", nil)
+	assert.NotNil(t, cookie)
+	assert.Equal(t, 1, store.Backend.(*MemoryBackend).Len())
+}
+
+// redisStandIn serves GET, SET, DEL and AUTH over the redis protocol.
+func redisStandIn(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+	var mu sync.Mutex
+	data := map[string]string{}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					reply, err := readRESP(r)
+					if err != nil {
+						return
+					}
+					var args []string
+					for _, arg := range reply.([]any) {
+						args = append(args, string(arg.([]byte)))
+					}
+					mu.Lock()
+					switch strings.ToUpper(args[0]) {
+					case "AUTH":
+						if args[1] == "pass" {
+							_, _ = conn.Write([]byte("+OK\r\n"))
+						} else {
+							_, _ = conn.Write([]byte("-ERR invalid password\r\n"))
+						}
+					case "SET":
+						data[args[1]] = args[2]
+						_, _ = conn.Write([]byte("+OK\r\n"))
+					case "GET":
+						if v, ok := data[args[1]]; ok {
+							_, _ = conn.Write([]byte("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"))
+						} else {
+							_, _ = conn.Write([]byte("$-1\r\n"))
+						}
+					case "DEL":
+						delete(data, args[1])
+						_, _ = conn.Write([]byte(":1\r\n"))
+					default:
+						_, _ = conn.Write([]byte("-ERR unknown command\r\n"))
+					}
+					mu.Unlock()
+				}
+			}(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestFlashes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	g := igin.New()
+	g.SetFuncMaps(FlashFuncMap())
+	g.SetHTMLTemplate(template.Must(template.New("page").Funcs(g.FuncMap).Parse(
+		`<h1>page</h1>{{ range flashes "error" }}<p class="{{ .Category }}">{{ .Message }}</p>{{ end }}`)))
+	g.Use(NextWithStore(sessions.NewCookieStore([]byte("secret"))))
+	g.GET("/save", func(c *gin.Context) {
+		_ = AddFlash(c, FlashError, "<failed>")
+		_ = AddFlash(c, FlashInfo, "info")
+		c.Redirect(http.StatusFound, "/page")
+	})
+	g.GET("/page", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "page", nil)
+	})
+	g.GET("/info", func(c *gin.Context) {
+		c.JSON(http.StatusOK, Flashes(c))
+	})
+
+	_, cookie := request(g, "/save", nil)
+	w, cookie := request(g, "/page", cookie)
+	assert.Equal(t, `<h1>page</h1><p class="error">&lt;failed&gt;</p>`, w.Body.String())
+	w, cookie = request(g, "/page", cookie)
+	assert.Equal(t, `<h1>page</h1>`, w.Body.String(), "flashes are consumed")
+	w, _ = request(g, "/info", cookie)
+	assert.JSONEq(t, `[{"Category":"info","Message":"info"}]`, w.Body.String())
+}
@@ -0,0 +1,302 @@
+package session
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/gob"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	fileSessionPrefix = "session_"
+	sweepInterval     = time.Minute
+)
+
+var sessionIDEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type (
+	// Backend persists encoded session values by session id.
+	Backend interface {
+		// Load returns the data stored for id, or nil when there is none or it expired.
+		Load(id string) ([]byte, error)
+		// Save stores data for id, it expires after ttl. A ttl <= 0 means no expiry.
+		Save(id string, data []byte, ttl time.Duration) error
+		// Delete removes the data stored for id.
+		Delete(id string) error
+	}
+
+	// ServerStore is a sessions.Store keeping session values server side in a Backend.
+	// The cookie only carries the signed session id.
+	ServerStore struct {
+		Codecs  []securecookie.Codec
+		Options *sessions.Options
+		Backend Backend
+	}
+)
+
+var _ sessions.Store = (*ServerStore)(nil)
+
+// NewServerStore returns a ServerStore saving values into backend.
+// keyPairs are used to sign (and optionally encrypt) the session id cookie, see sessions.NewCookieStore.
+func NewServerStore(backend Backend, keyPairs ...[]byte) *ServerStore {
+	s := &ServerStore{
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:   "/",
+			MaxAge: 86400 * 30,
+		},
+		Backend: backend,
+	}
+	s.MaxAge(s.Options.MaxAge)
+	return s
+}
+
+// NewMemoryStore returns a ServerStore keeping values in memory.
+func NewMemoryStore(keyPairs ...[]byte) *ServerStore {
+	return NewServerStore(NewMemoryBackend(), keyPairs...)
+}
+
+// NewFilesystemStore returns a ServerStore keeping values in files under dir.
+// An empty dir uses os.TempDir().
+func NewFilesystemStore(dir string, keyPairs ...[]byte) *ServerStore {
+	return NewServerStore(NewFileBackend(dir), keyPairs...)
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *ServerStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the registry.
+func (s *ServerStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	if err := securecookie.DecodeMulti(name, cookie.Value, &session.ID, s.Codecs...); err != nil {
+		return session, err
+	}
+	data, err := s.Backend.Load(session.ID)
+	if err != nil {
+		return session, err
+	}
+	if data == nil {
+		// expired or unknown ids are not reused
+		session.ID = ""
+		return session, nil
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&session.Values); err != nil {
+		return session, err
+	}
+	session.IsNew = false
+	return session, nil
+}
+
+// Save adds a single session to the response.
+// A session with Options.MaxAge <= 0 is deleted from the backend.
+func (s *ServerStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge <= 0 {
+		if session.ID != "" {
+			if err := s.Backend.Delete(session.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+	if session.ID == "" {
+		session.ID = sessionIDEncoding.EncodeToString(securecookie.GenerateRandomKey(32))
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(session.Values); err != nil {
+		return err
+	}
+	if err := s.Backend.Save(session.ID, buf.Bytes(), time.Duration(session.Options.MaxAge)*time.Second); err != nil {
+		return err
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// MaxAge sets the maximum age for the store and the underlying cookie implementation.
+func (s *ServerStore) MaxAge(age int) {
+	s.Options.MaxAge = age
+	for _, codec := range s.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(age)
+		}
+	}
+}
+
+type memoryEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+// MemoryBackend is an in-memory Backend. Expired entries are evicted on access and swept periodically.
+type MemoryBackend struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	sweep   time.Time
+}
+
+// NewMemoryBackend returns an empty MemoryBackend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{entries: make(map[string]memoryEntry)}
+}
+
+func (m *MemoryBackend) Load(id string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[id]
+	if !ok {
+		return nil, nil
+	}
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		delete(m.entries, id)
+		return nil, nil
+	}
+	return entry.data, nil
+}
+
+func (m *MemoryBackend) Save(id string, data []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if now.After(m.sweep) {
+		for k, entry := range m.entries {
+			if !entry.expires.IsZero() && now.After(entry.expires) {
+				delete(m.entries, k)
+			}
+		}
+		m.sweep = now.Add(sweepInterval)
+	}
+	entry := memoryEntry{data: data}
+	if ttl > 0 {
+		entry.expires = now.Add(ttl)
+	}
+	m.entries[id] = entry
+	return nil
+}
+
+func (m *MemoryBackend) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, id)
+	return nil
+}
+
+// Len returns the number of stored entries, including expired ones not swept yet.
+func (m *MemoryBackend) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
+
+// FileBackend is a Backend storing every session in its own file.
+// The file starts with the unix expiry time, expired files are removed on access and swept periodically.
+type FileBackend struct {
+	dir   string
+	mu    sync.RWMutex
+	sweep time.Time
+}
+
+// NewFileBackend returns a FileBackend storing files under dir.
+func NewFileBackend(dir string) *FileBackend {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return &FileBackend{dir: dir}
+}
+
+func (f *FileBackend) filename(id string) string {
+	return filepath.Join(f.dir, fileSessionPrefix+filepath.Base(id))
+}
+
+func (f *FileBackend) Load(id string) ([]byte, error) {
+	f.mu.RLock()
+	data, err := os.ReadFile(f.filename(id))
+	f.mu.RUnlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, nil
+	}
+	if expires := int64(binary.BigEndian.Uint64(data)); expires > 0 && time.Now().Unix() > expires {
+		return nil, f.Delete(id)
+	}
+	return data[8:], nil
+}
+
+func (f *FileBackend) Save(id string, data []byte, ttl time.Duration) error {
+	var expires int64
+	if ttl > 0 {
+		expires = time.Now().Add(ttl).Unix()
+	}
+	buf := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint64(buf, uint64(expires))
+	buf = append(buf, data...)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if now := time.Now(); now.After(f.sweep) {
+		f.sweepExpired(now)
+		f.sweep = now.Add(sweepInterval)
+	}
+	return os.WriteFile(f.filename(id), buf, 0600)
+}
+
+func (f *FileBackend) Delete(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := os.Remove(f.filename(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// sweepExpired removes expired session files, f.mu must be held.
+func (f *FileBackend) sweepExpired(now time.Time) {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return
+	}
+	header := make([]byte, 8)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), fileSessionPrefix) {
+			continue
+		}
+		name := filepath.Join(f.dir, entry.Name())
+		file, err := os.Open(name)
+		if err != nil {
+			continue
+		}
+		n, _ := file.Read(header)
+		file.Close()
+		if n == 8 {
+			if expires := int64(binary.BigEndian.Uint64(header)); expires > 0 && now.Unix() > expires {
+				_ = os.Remove(name)
+			}
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/pkg6/igin/xerror"
+)
+
+const (
+	SignatureEncodingHex    = "hex"
+	SignatureEncodingBase64 = "base64"
+)
+
+type (
+	// SignatureConfig defines the config for Signature middleware.
+	SignatureConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+		// ErrorHandler defines a function which is executed for a missing or invalid signature.
+		ErrorHandler ErrorHandler
+		// Secrets used to verify signatures. A signature is accepted when it matches any of them, which allows
+		// rotating secrets by adding the new one before removing the old one.
+		// Signing always uses the first secret.
+		// Required.
+		Secrets []string
+		// Hash used for the hmac.
+		// Optional. Default value sha256.New.
+		Hash func() hash.Hash
+		// Encoding of the signature, SignatureEncodingHex or SignatureEncodingBase64.
+		// Optional. Default value SignatureEncodingHex.
+		Encoding string
+		// SignatureHeader is the header carrying the signature.
+		// Optional. Default value "X-Signature".
+		SignatureHeader string
+		// SignaturePrefix is cut from the signature header value, e.g. "sha256=".
+		// Optional. Default value "".
+		SignaturePrefix string
+		// TimestampHeader is the header carrying the unix timestamp the request was signed at.
+		// When set the timestamp is part of the signed payload and checked against Tolerance.
+		// Optional. Default value "".
+		TimestampHeader string
+		// Tolerance is the maximum age of a signed timestamp.
+		// Optional. Default value 5 minutes.
+		Tolerance time.Duration
+		// Headers are additional request headers included into the signed payload.
+		// Optional.
+		Headers []string
+		// ParseSignature extracts the timestamp and signatures from the request.
+		// Optional. Defaults to reading TimestampHeader and SignatureHeader.
+		ParseSignature func(c *gin.Context) (timestamp string, signatures []string, err error)
+		// ReplayCache rejects signatures that were already used within Tolerance.
+		// It is only used when the request carries a timestamp.
+		// Optional. Default value is an in-memory cache.
+		ReplayCache ReplayCache
+		// MaxBodySize limits the body read for verification.
+		// Optional. Default value 10MB.
+		MaxBodySize int64
+	}
+
+	// ReplayCache records used signatures.
+	ReplayCache interface {
+		// Seen reports whether key was already recorded and records it until expiration otherwise.
+		Seen(key string, expiration time.Time) bool
+	}
+)
+
+var (
+	// DefaultSignatureConfig is the default Signature middleware config.
+	defaultSignatureConfig = SignatureConfig{
+		Skipper:         DefaultSkipper,
+		ErrorHandler:    DefaultErrorHandler,
+		Hash:            sha256.New,
+		Encoding:        SignatureEncodingHex,
+		SignatureHeader: igin.HeaderXSignature,
+		Tolerance:       5 * time.Minute,
+		MaxBodySize:     10 << 20,
+	}
+	ErrSignatureMissing  = xerror.NewHTTPError(http.StatusBadRequest, "missing or malformed signature")
+	ErrSignatureInvalid  = xerror.NewHTTPError(http.StatusUnauthorized, "invalid signature")
+	ErrSignatureExpired  = xerror.NewHTTPError(http.StatusUnauthorized, "signature timestamp outside of tolerance")
+	ErrSignatureReplayed = xerror.NewHTTPError(http.StatusUnauthorized, "signature already used")
+	ErrSignatureBodySize = xerror.NewHTTPError(http.StatusRequestEntityTooLarge, "request body too large")
+)
+
+// SignatureNext returns a Signature middleware verifying X-Signature with secrets.
+func SignatureNext(secrets ...string) gin.HandlerFunc {
+	c := defaultSignatureConfig
+	c.Secrets = secrets
+	return SignatureNextWithConfig(c)
+}
+
+// GitHubSignatureConfig returns a config verifying GitHub webhooks (X-Hub-Signature-256: sha256=<hex>).
+func GitHubSignatureConfig(secrets ...string) SignatureConfig {
+	c := defaultSignatureConfig
+	c.Secrets = secrets
+	c.SignatureHeader = igin.HeaderXHubSignature256
+	c.SignaturePrefix = "sha256="
+	return c
+}
+
+// StripeSignatureConfig returns a config verifying Stripe style signatures
+// (Stripe-Signature: t=<timestamp>,v1=<hex>,v1=<hex>) signed over "<timestamp>.<body>".
+func StripeSignatureConfig(secrets ...string) SignatureConfig {
+	c := defaultSignatureConfig
+	c.Secrets = secrets
+	c.SignatureHeader = igin.HeaderStripeSignature
+	c.ParseSignature = func(c *gin.Context) (string, []string, error) {
+		var timestamp string
+		var signatures []string
+		for _, part := range strings.Split(c.Request.Header.Get(igin.HeaderStripeSignature), ",") {
+			k, v, found := strings.Cut(strings.TrimSpace(part), "=")
+			if !found {
+				continue
+			}
+			switch k {
+			case "t":
+				timestamp = v
+			case "v1":
+				signatures = append(signatures, v)
+			}
+		}
+		if timestamp == "" || len(signatures) == 0 {
+			return "", nil, ErrSignatureMissing
+		}
+		return timestamp, signatures, nil
+	}
+	return c
+}
+
+func signatureConfigDefaults(config SignatureConfig) SignatureConfig {
+	if config.Skipper == nil {
+		config.Skipper = defaultSignatureConfig.Skipper
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = defaultSignatureConfig.ErrorHandler
+	}
+	if config.Hash == nil {
+		config.Hash = defaultSignatureConfig.Hash
+	}
+	if config.Encoding == "" {
+		config.Encoding = defaultSignatureConfig.Encoding
+	}
+	if config.SignatureHeader == "" {
+		config.SignatureHeader = defaultSignatureConfig.SignatureHeader
+	}
+	if config.Tolerance == 0 {
+		config.Tolerance = defaultSignatureConfig.Tolerance
+	}
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = defaultSignatureConfig.MaxBodySize
+	}
+	if config.ParseSignature == nil {
+		config.ParseSignature = config.defaultParseSignature
+	}
+	if len(config.Secrets) == 0 {
+		panic("IGin: signature middleware requires secrets")
+	}
+	return config
+}
+
+// SignatureNextWithConfig returns a Signature middleware with config.
+// The body is restored after verification and stored under gin.BodyBytesKey, so it can be bound again.
+func SignatureNextWithConfig(config SignatureConfig) gin.HandlerFunc {
+	config = signatureConfigDefaults(config)
+	if config.ReplayCache == nil {
+		config.ReplayCache = NewMemoryReplayCache()
+	}
+	return func(c *gin.Context) {
+		if config.Skipper(c) {
+			c.Next()
+			return
+		}
+		timestamp, signatures, err := config.ParseSignature(c)
+		if err != nil || len(signatures) == 0 {
+			config.ErrorHandler(c, ErrSignatureMissing, ErrSignatureMissing.Code)
+			return
+		}
+		var signedAt time.Time
+		if timestamp != "" {
+			unix, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil {
+				config.ErrorHandler(c, ErrSignatureMissing, ErrSignatureMissing.Code)
+				return
+			}
+			signedAt = time.Unix(unix, 0)
+			if d := time.Since(signedAt); d > config.Tolerance || d < -config.Tolerance {
+				config.ErrorHandler(c, ErrSignatureExpired, ErrSignatureExpired.Code)
+				return
+			}
+		}
+		body, err := readRequestBody(c, config.MaxBodySize)
+		if err != nil {
+			config.ErrorHandler(c, ErrSignatureBodySize, ErrSignatureBodySize.Code)
+			return
+		}
+		payload := config.payload(timestamp, c.Request.Header, body)
+		var matched []byte
+	outer:
+		for _, secret := range config.Secrets {
+			expected := config.mac(secret, payload)
+			for _, signature := range signatures {
+				if hmac.Equal(expected, config.decode(signature)) {
+					matched = expected
+					break outer
+				}
+			}
+		}
+		if matched == nil {
+			config.ErrorHandler(c, ErrSignatureInvalid, ErrSignatureInvalid.Code)
+			return
+		}
+		// keyed on the verified mac, not on its encoding which may be re-cased or re-padded
+		if timestamp != "" && config.ReplayCache.Seen(hex.EncodeToString(matched), signedAt.Add(config.Tolerance)) {
+			config.ErrorHandler(c, ErrSignatureReplayed, ErrSignatureReplayed.Code)
+			return
+		}
+		c.Next()
+	}
+}
+
+// SignRequest signs req with the first secret of config so that SignatureNextWithConfig(config) accepts it.
+// The signature is written to SignatureHeader and TimestampHeader, a custom ParseSignature is not taken into account.
+// The body is read and restored.
+func SignRequest(req *http.Request, config SignatureConfig) error {
+	config = signatureConfigDefaults(config)
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		_ = req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	timestamp := ""
+	if config.TimestampHeader != "" {
+		timestamp = strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(config.TimestampHeader, timestamp)
+	}
+	signature := config.encode(config.mac(config.Secrets[0], config.payload(timestamp, req.Header, body)))
+	req.Header.Set(config.SignatureHeader, config.SignaturePrefix+signature)
+	return nil
+}
+
+func (config *SignatureConfig) defaultParseSignature(c *gin.Context) (string, []string, error) {
+	var signatures []string
+	for _, value := range c.Request.Header.Values(config.SignatureHeader) {
+		if config.SignaturePrefix != "" {
+			if !strings.HasPrefix(value, config.SignaturePrefix) {
+				continue
+			}
+			value = value[len(config.SignaturePrefix):]
+		}
+		signatures = append(signatures, value)
+		if len(signatures) >= extractorLimit {
+			break
+		}
+	}
+	if len(signatures) == 0 {
+		return "", nil, ErrSignatureMissing
+	}
+	timestamp := ""
+	if config.TimestampHeader != "" {
+		if timestamp = c.Request.Header.Get(config.TimestampHeader); timestamp == "" {
+			return "", nil, ErrSignatureMissing
+		}
+	}
+	return timestamp, signatures, nil
+}
+
+// payload builds the signed content: "[<timestamp>.][<header>:<value>\n...]<body>"
+func (config *SignatureConfig) payload(timestamp string, header http.Header, body []byte) []byte {
+	var buf bytes.Buffer
+	if timestamp != "" {
+		buf.WriteString(timestamp)
+		buf.WriteByte('.')
+	}
+	for _, name := range config.Headers {
+		buf.WriteString(strings.ToLower(name))
+		buf.WriteByte(':')
+		buf.WriteString(header.Get(name))
+		buf.WriteByte('\n')
+	}
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+func (config *SignatureConfig) mac(secret string, payload []byte) []byte {
+	h := hmac.New(config.Hash, []byte(secret))
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+func (config *SignatureConfig) encode(sum []byte) string {
+	if config.Encoding == SignatureEncodingBase64 {
+		return base64.StdEncoding.EncodeToString(sum)
+	}
+	return hex.EncodeToString(sum)
+}
+
+func (config *SignatureConfig) decode(signature string) []byte {
+	var sum []byte
+	if config.Encoding == SignatureEncodingBase64 {
+		sum, _ = base64.StdEncoding.DecodeString(signature)
+	} else {
+		sum, _ = hex.DecodeString(signature)
+	}
+	return sum
+}
+
+func readRequestBody(c *gin.Context, limit int64) ([]byte, error) {
+	if c.Request.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, errors.New("request body too large")
+	}
+	// 将原body塞回去
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	c.Set(gin.BodyBytesKey, body)
+	return body, nil
+}
+
+// MemoryReplayCache is an in-memory ReplayCache.
+type MemoryReplayCache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+	sweep   time.Time
+}
+
+// NewMemoryReplayCache returns an empty MemoryReplayCache.
+func NewMemoryReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{entries: make(map[string]time.Time)}
+}
+
+func (m *MemoryReplayCache) Seen(key string, expiration time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if now.After(m.sweep) {
+		for k, exp := range m.entries {
+			if now.After(exp) {
+				delete(m.entries, k)
+			}
+		}
+		m.sweep = now.Add(time.Minute)
+	}
+	if exp, ok := m.entries[key]; ok && now.Before(exp) {
+		return true
+	}
+	m.entries[key] = expiration
+	return false
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/stretchr/testify/assert"
+)
+
+func signatureEngine(config SignatureConfig, body *string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.Use(SignatureNextWithConfig(config))
+	g.POST("/", func(c *gin.Context) {
+		b, _ := io.ReadAll(c.Request.Body)
+		*body = string(b)
+		c.Status(http.StatusOK)
+	})
+	return g
+}
+
+func TestSignatureNext(t *testing.T) {
+	config := SignatureConfig{Secrets: []string{"new", "old"}, TimestampHeader: "X-Signature-Timestamp"}
+	var body string
+	g := signatureEngine(config, &body)
+
+	signer := config
+	signer.Secrets = []string{"old"}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"id":1}`))
+	assert.NoError(t, SignRequest(req, signer))
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"id":1}`, body)
+
+	// replay
+	req.Body = io.NopCloser(strings.NewReader(`{"id":1}`))
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// replay with the hex re-cased
+	req.Header.Set(igin.HeaderXSignature, strings.ToUpper(req.Header.Get(igin.HeaderXSignature)))
+	req.Body = io.NopCloser(strings.NewReader(`{"id":1}`))
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), ErrSignatureReplayed.Message)
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"id":1}`))
+	assert.NoError(t, SignRequest(req, signer))
+	req.Body = io.NopCloser(strings.NewReader(`{"id":2}`))
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"id":1}`))
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGitHubSignature(t *testing.T) {
+	var body string
+	g := signatureEngine(GitHubSignatureConfig("It's a Secret to Everybody"), &body)
+	// https://docs.github.com/en/webhooks/using-webhooks/validating-webhook-deliveries#testing-the-webhook-payload-validation
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("Hello, World!"))
+	req.Header.Set("X-Hub-Signature-256", "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17")
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Hello, World!", body)
+}
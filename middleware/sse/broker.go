@@ -0,0 +1,327 @@
+package sse
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+)
+
+type (
+	// Config defines the config for Broker.
+	Config struct {
+		// BufferSize is the number of events kept per topic to replay to reconnecting clients.
+		// Optional. Default value 100.
+		BufferSize int
+		// ClientBuffer is the number of events queued per client, clients falling further behind are disconnected
+		// and replay the missed events when reconnecting.
+		// Optional. Default value 32.
+		ClientBuffer int
+		// Heartbeat is the interval of comments sent to keep idle connections open, it must not be negative.
+		// Optional. Default value 15 seconds.
+		Heartbeat time.Duration
+		// Retry is sent to clients when connecting as their reconnection delay.
+		// Optional. Default value 0, browsers use their own delay.
+		Retry time.Duration
+		// TopicQuery is the query parameter the topics are read from when the handler has none.
+		// Optional. Default value "topic".
+		TopicQuery string
+		// Authorize reports whether the request may subscribe to topic, the request is rejected with 403 otherwise.
+		// Required for handlers reading the topics from TopicQuery, optional for handlers with fixed topics.
+		Authorize func(c *gin.Context, topic string) bool
+	}
+
+	// Broker fans out published events to the clients subscribed to their topic.
+	Broker struct {
+		config Config
+		mu     sync.Mutex
+		seq    uint64
+		topics map[string]*topic
+		closed chan struct{}
+		once   sync.Once
+	}
+
+	// Subscription receives the events of its topics until it is closed.
+	Subscription struct {
+		// Events receives the published events.
+		Events <-chan Event
+		// Done is closed when the subscription ends, because it was closed, it fell behind or the broker was closed.
+		Done   <-chan struct{}
+		broker *Broker
+		client *client
+	}
+
+	topic struct {
+		clients map[*client]struct{}
+		buffer  []entry
+	}
+
+	entry struct {
+		seq   uint64
+		event Event
+	}
+
+	client struct {
+		topics []string
+		events chan Event
+		done   chan struct{}
+		once   sync.Once
+	}
+)
+
+var (
+	// DefaultConfig is the default Broker config.
+	defaultConfig = Config{
+		BufferSize:   100,
+		ClientBuffer: 32,
+		Heartbeat:    15 * time.Second,
+		TopicQuery:   "topic",
+	}
+)
+
+// NewBroker returns a Broker with config.
+func NewBroker(config Config) *Broker {
+	// Defaults
+	if config.BufferSize == 0 {
+		config.BufferSize = defaultConfig.BufferSize
+	}
+	if config.ClientBuffer == 0 {
+		config.ClientBuffer = defaultConfig.ClientBuffer
+	}
+	if config.Heartbeat == 0 {
+		config.Heartbeat = defaultConfig.Heartbeat
+	}
+	if config.Heartbeat < 0 || config.BufferSize < 0 || config.ClientBuffer < 0 {
+		panic("IGin: sse broker requires a positive Heartbeat, BufferSize and ClientBuffer")
+	}
+	if config.TopicQuery == "" {
+		config.TopicQuery = defaultConfig.TopicQuery
+	}
+	return &Broker{config: config, topics: map[string]*topic{}, closed: make(chan struct{})}
+}
+
+// Publish sends event to the clients subscribed to name and keeps it for replay.
+// An empty ID is set to an increasing number.
+func (b *Broker) Publish(name string, event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	if event.ID == "" {
+		event.ID = strconv.FormatUint(b.seq, 10)
+	}
+	t := b.topic(name)
+	t.buffer = append(t.buffer, entry{seq: b.seq, event: event})
+	if len(t.buffer) > b.config.BufferSize {
+		t.buffer = t.buffer[len(t.buffer)-b.config.BufferSize:]
+	}
+	for cl := range t.clients {
+		select {
+		case cl.events <- event:
+		default:
+			// too slow, the client replays the missed events after reconnecting
+			b.remove(cl)
+		}
+	}
+}
+
+// Subscribe returns a Subscription to topics, the buffered events after lastEventID are queued first.
+// Events with custom ids are replayed while they are buffered, numeric ids assigned by Publish also after.
+func (b *Broker) Subscribe(lastEventID string, topics ...string) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cl := &client{topics: topics, done: make(chan struct{})}
+	replay := b.replay(lastEventID, topics)
+	cl.events = make(chan Event, len(replay)+b.config.ClientBuffer)
+	for _, event := range replay {
+		cl.events <- event
+	}
+	select {
+	case <-b.closed:
+		cl.close()
+	default:
+		for _, name := range topics {
+			b.topic(name).clients[cl] = struct{}{}
+		}
+	}
+	return &Subscription{Events: cl.events, Done: cl.done, broker: b, client: cl}
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.remove(s.client)
+}
+
+// Clients returns the number of clients subscribed to name.
+func (b *Broker) Clients(name string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t, ok := b.topics[name]; ok {
+		return len(t.clients)
+	}
+	return 0
+}
+
+// Close ends all subscriptions, the handlers return and new subscriptions end immediately.
+func (b *Broker) Close() {
+	b.once.Do(func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		close(b.closed)
+		for _, t := range b.topics {
+			for cl := range t.clients {
+				b.remove(cl)
+			}
+		}
+	})
+}
+
+// Handler returns a handler streaming the events of topics, or of the topics in Config.TopicQuery when none
+// are given, which requires Config.Authorize. Buffered events after the Last-Event-ID header are replayed,
+// heartbeat comments keep the connection open and the client is unsubscribed when the request ends.
+func (b *Broker) Handler(topics ...string) gin.HandlerFunc {
+	if len(topics) == 0 && b.config.Authorize == nil {
+		panic("IGin: sse handler without topics requires Config.Authorize")
+	}
+	return func(c *gin.Context) {
+		names := topics
+		if len(names) == 0 {
+			names = c.QueryArray(b.config.TopicQuery)
+		}
+		if len(names) == 0 {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if b.config.Authorize != nil {
+			for _, name := range names {
+				if !b.config.Authorize(c, name) {
+					c.AbortWithStatus(http.StatusForbidden)
+					return
+				}
+			}
+		}
+		lastEventID := c.GetHeader(igin.HeaderLastEventID)
+		if lastEventID == "" {
+			// EventSource polyfills without header support
+			lastEventID = c.Query("lastEventId")
+		}
+		sub := b.Subscribe(lastEventID, names...)
+		defer sub.Close()
+
+		header := c.Writer.Header()
+		header.Set(igin.HeaderContentType, igin.MIMEEventStream)
+		header.Set(igin.HeaderCacheControl, "no-cache")
+		header.Set(igin.HeaderConnection, "keep-alive")
+		header.Set(igin.HeaderXAccelBuffering, "no")
+		c.Status(http.StatusOK)
+		if b.config.Retry > 0 {
+			if err := writeRetry(c.Writer, b.config.Retry); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+
+		heartbeat := time.NewTicker(b.config.Heartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case event := <-sub.Events:
+				if _, err := event.WriteTo(c.Writer); err != nil {
+					return
+				}
+				// write the queued events before flushing
+				for queued := len(sub.Events); queued > 0; queued-- {
+					if _, err := (<-sub.Events).WriteTo(c.Writer); err != nil {
+						return
+					}
+				}
+			case <-sub.Done:
+				return
+			case <-heartbeat.C:
+				if err := writeComment(c.Writer, "heartbeat"); err != nil {
+					return
+				}
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// topic returns the topic name, creating it. b.mu must be held.
+func (b *Broker) topic(name string) *topic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &topic{clients: map[*client]struct{}{}}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// remove unsubscribes cl from its topics and ends it. b.mu must be held.
+func (b *Broker) remove(cl *client) {
+	for _, name := range cl.topics {
+		if t, ok := b.topics[name]; ok {
+			delete(t.clients, cl)
+			if len(t.clients) == 0 && len(t.buffer) == 0 {
+				delete(b.topics, name)
+			}
+		}
+	}
+	cl.close()
+}
+
+// replay returns the buffered events of topics after lastEventID in publishing order. b.mu must be held.
+func (b *Broker) replay(lastEventID string, topics []string) []Event {
+	if lastEventID == "" {
+		return nil
+	}
+	var after uint64
+	found := false
+	for _, name := range topics {
+		if t, ok := b.topics[name]; ok {
+			for _, e := range t.buffer {
+				if e.event.ID == lastEventID {
+					after, found = e.seq, true
+				}
+			}
+		}
+	}
+	if !found {
+		seq, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			return nil
+		}
+		after = seq
+	}
+	var entries []entry
+	for _, name := range topics {
+		if t, ok := b.topics[name]; ok {
+			for _, e := range t.buffer {
+				if e.seq > after {
+					entries = append(entries, e)
+				}
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].seq < entries[j].seq
+	})
+	events := make([]Event, len(entries))
+	for i, e := range entries {
+		events[i] = e.event
+	}
+	return events
+}
+
+func (cl *client) close() {
+	cl.once.Do(func() {
+		close(cl.done)
+	})
+}
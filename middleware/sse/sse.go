@@ -0,0 +1,64 @@
+package sse
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a server-sent event.
+type Event struct {
+	// ID is sent as the "id" field, browsers send the last one as Last-Event-ID when reconnecting.
+	// Broker.Publish assigns an increasing number when empty.
+	ID string
+	// Event is sent as the "event" field, the name of the listener called in the browser.
+	// Optional. Browsers default to "message".
+	Event string
+	// Data is sent as "data" fields, one per line.
+	Data string
+	// Retry is sent as the "retry" field, the reconnection delay of the browser.
+	// Optional.
+	Retry time.Duration
+}
+
+// WriteTo writes the event in the text/event-stream format.
+func (e Event) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	if e.ID != "" {
+		b.WriteString("id: " + singleLine(e.ID) + "\n")
+	}
+	if e.Event != "" {
+		b.WriteString("event: " + singleLine(e.Event) + "\n")
+	}
+	if e.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+	}
+	// browsers end lines at "\r\n", "\r" and "\n", a line end not followed by "data: " would start a new field
+	for _, line := range strings.Split(lineEnds.Replace(e.Data), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteByte('\n')
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// writeRetry sets the reconnection delay without dispatching an event.
+func writeRetry(w io.Writer, retry time.Duration) error {
+	_, err := io.WriteString(w, "retry: "+strconv.FormatInt(retry.Milliseconds(), 10)+"\n\n")
+	return err
+}
+
+// writeComment writes a comment line, ignored by browsers but keeping the connection alive.
+func writeComment(w io.Writer, comment string) error {
+	_, err := io.WriteString(w, ": "+singleLine(comment)+"\n\n")
+	return err
+}
+
+// lineEnds normalizes the line ends of the event stream to "\n".
+var lineEnds = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// singleLine keeps field values from starting new fields.
+func singleLine(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
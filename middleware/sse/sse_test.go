@@ -0,0 +1,117 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventWriteTo(t *testing.T) {
+	var b strings.Builder
+	_, err := Event{ID: "7", Event: "update", Data: "line 1\nline 2", Retry: 2 * time.Second}.WriteTo(&b)
+	assert.NoError(t, err)
+	assert.Equal(t, "id: 7\nevent: update\nretry: 2000\ndata: line 1\ndata: line 2\n\n", b.String())
+
+	b.Reset()
+	_, err = Event{Data: "a\r\nb\rid: 99\revent: spoofed\nretry: 1"}.WriteTo(&b)
+	assert.NoError(t, err)
+	assert.Equal(t, "data: a\ndata: b\ndata: id: 99\ndata: event: spoofed\ndata: retry: 1\n\n", b.String(),
+		"every line end starts a data field")
+}
+
+func TestBroker(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	broker := NewBroker(Config{
+		BufferSize: 2,
+		Heartbeat:  20 * time.Millisecond,
+		Retry:      time.Second,
+		Authorize: func(c *gin.Context, topic string) bool {
+			return topic != "admin"
+		},
+	})
+	defer broker.Close()
+	g := gin.New()
+	g.GET("/events", broker.Handler())
+	server := httptest.NewServer(g)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events?topic=news&topic=admin")
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	broker.Publish("news", Event{Data: "a"})
+	broker.Publish("news", Event{Data: "b"})
+	broker.Publish("news", Event{Data: "c"})
+	broker.Publish("sport", Event{Data: "d"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/events?topic=news", nil)
+	req.Header.Set(igin.HeaderLastEventID, "1")
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, igin.MIMEEventStream, resp.Header.Get(igin.HeaderContentType))
+
+	lines := make(chan string, 100)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	next := func(skip ...string) string {
+		for line := range lines {
+			if line != "" && (len(skip) == 0 || line != skip[0]) {
+				return line
+			}
+		}
+		return ""
+	}
+
+	assert.Equal(t, "retry: 1000", next())
+	assert.Equal(t, "id: 2", next(), "events after Last-Event-ID are replayed")
+	assert.Equal(t, "data: b", next())
+	assert.Equal(t, "id: 3", next())
+	assert.Equal(t, "data: c", next())
+	assert.Equal(t, ": heartbeat", next())
+	assert.Equal(t, 1, broker.Clients("news"))
+
+	broker.Publish("news", Event{ID: "custom", Event: "breaking", Data: "e"})
+	assert.Equal(t, "id: custom", next(": heartbeat"))
+	assert.Equal(t, "event: breaking", next())
+	assert.Equal(t, "data: e", next())
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		return broker.Clients("news") == 0
+	}, time.Second, 10*time.Millisecond, "the client is unsubscribed when the request ends")
+
+	sub := broker.Subscribe("custom", "news", "sport")
+	broker.Publish("sport", Event{Data: "f"})
+	assert.Equal(t, "f", (<-sub.Events).Data)
+	sub.Close()
+	_, open := <-sub.Done
+	assert.False(t, open)
+}
+
+func TestBrokerConfig(t *testing.T) {
+	assert.PanicsWithValue(t, "IGin: sse broker requires a positive Heartbeat, BufferSize and ClientBuffer", func() {
+		NewBroker(Config{Heartbeat: -time.Second})
+	})
+	assert.PanicsWithValue(t, "IGin: sse handler without topics requires Config.Authorize", func() {
+		NewBroker(Config{}).Handler()
+	})
+	assert.NotPanics(t, func() {
+		NewBroker(Config{}).Handler("news")
+	})
+}
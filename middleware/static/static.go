@@ -0,0 +1,280 @@
+package static
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/pkg6/igin/middleware"
+)
+
+type (
+	// Config defines the config for the static plugin.
+	Config struct {
+		// FS is the file system served, e.g. an embed.FS or os.DirFS("dist").
+		// Required.
+		FS fs.FS
+		// Root is the directory inside FS served, e.g. "dist" for a `//go:embed dist` directive.
+		// Optional. Default value ".".
+		Root string
+		// Path the plugin is registered under.
+		// Optional. Default value "/".
+		Path string
+		// Index is the file served for directories.
+		// Optional. Default value "index.html".
+		Index string
+		// SPA serves the root index for unknown paths without file extension, so the client side router handles them.
+		// Optional. Default value false.
+		SPA bool
+		// ExcludePrefixes are paths which never fall back to the index, e.g. the api of the application.
+		// Optional. Default value []string{"/api"}.
+		ExcludePrefixes []string
+		// Fingerprinted matches the names of files whose content never changes, they are cached for a year.
+		// Optional. Default value matches names with a hex hash like "app.3f2a1b9c.js" or "app-3f2a1b9c.css".
+		Fingerprinted *regexp.Regexp
+		// CacheControl is sent for files not fingerprinted.
+		// Optional. Default value "no-cache", browsers revalidate with the ETag.
+		CacheControl string
+	}
+
+	// Server is an igin.IPlugin serving the files of a fs.FS.
+	//
+	// Files are served with ETags and support Range and conditional requests. When the request accepts it,
+	// a precompressed "<name>.br" or "<name>.gz" sibling is served with the Content-Encoding set.
+	Server struct {
+		config Config
+		fsys   fs.FS
+		etags  sync.Map // etagKey -> string
+	}
+
+	etagKey struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+)
+
+var (
+	// DefaultConfig is the default static config.
+	defaultConfig = Config{
+		Path:            "/",
+		Index:           "index.html",
+		ExcludePrefixes: []string{"/api"},
+		Fingerprinted:   regexp.MustCompile(`[.-][0-9a-fA-F]{8,}\.[0-9A-Za-z]+$`),
+		CacheControl:    "no-cache",
+	}
+	// precompressed are the encodings served from siblings, by preference.
+	precompressed = []struct{ encoding, ext string }{
+		{"br", ".br"},
+		{"gzip", ".gz"},
+	}
+)
+
+var _ igin.IPlugin = (*Server)(nil)
+
+// New returns the static plugin.
+//
+// Register it under a path with igin.Engine.Plugin. To serve an application at "/" next to other routes
+// use the handler as the NoRoute handler, gin does not allow a root wildcard next to other routes:
+//
+//	//go:embed dist
+//	var dist embed.FS
+//
+//	e.NoRoute(static.New(static.Config{FS: dist, Root: "dist", SPA: true}).Handler())
+func New(config Config) *Server {
+	if config.FS == nil {
+		panic("IGin: static requires a file system")
+	}
+	if config.Root == "" {
+		config.Root = "."
+	}
+	if config.Path == "" {
+		config.Path = defaultConfig.Path
+	}
+	if config.Index == "" {
+		config.Index = defaultConfig.Index
+	}
+	if config.ExcludePrefixes == nil {
+		config.ExcludePrefixes = defaultConfig.ExcludePrefixes
+	}
+	if config.Fingerprinted == nil {
+		config.Fingerprinted = defaultConfig.Fingerprinted
+	}
+	if config.CacheControl == "" {
+		config.CacheControl = defaultConfig.CacheControl
+	}
+	fsys, err := fs.Sub(config.FS, config.Root)
+	if err != nil {
+		panic(err)
+	}
+	return &Server{config: config, fsys: fsys}
+}
+
+// RouterPath igin.IPlugin
+func (s *Server) RouterPath() string {
+	return s.config.Path
+}
+
+// Register igin.IPlugin registers the GET and HEAD routes of the files.
+func (s *Server) Register(group *gin.RouterGroup) {
+	group.GET("/*filepath", s.Handler())
+	group.HEAD("/*filepath", s.Handler())
+}
+
+// Handler returns the handler serving the files, the request path is relative to Config.Path.
+func (s *Server) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			return
+		}
+		name := c.Param("filepath")
+		if name == "" {
+			name = strings.TrimPrefix(c.Request.URL.Path, strings.TrimSuffix(s.config.Path, "/"))
+		}
+		name = strings.TrimPrefix(path.Clean("/"+name), "/")
+		if name == "" {
+			name = "."
+		}
+		if s.serve(c, name) {
+			return
+		}
+		if s.config.SPA && s.fallback(c.Request.URL.Path) && s.serve(c, ".") {
+			return
+		}
+		c.AbortWithStatus(http.StatusNotFound)
+	}
+}
+
+// fallback reports whether the index is served for the unknown requestPath.
+func (s *Server) fallback(requestPath string) bool {
+	for _, prefix := range s.config.ExcludePrefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if requestPath == prefix || strings.HasPrefix(requestPath, prefix+"/") {
+			return false
+		}
+	}
+	return path.Ext(requestPath) == ""
+}
+
+// serve writes the file name, the index for directories, and reports whether it exists.
+func (s *Server) serve(c *gin.Context, name string) bool {
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		return false
+	}
+	if info.IsDir() {
+		name = path.Join(name, s.config.Index)
+		if info, err = fs.Stat(s.fsys, name); err != nil || info.IsDir() {
+			return false
+		}
+	}
+	header := c.Writer.Header()
+	servedName, servedInfo, encoding := name, info, ""
+	acceptEncoding := c.Request.Header.Get(igin.HeaderAcceptEncoding)
+	for _, p := range precompressed {
+		sibling, err := fs.Stat(s.fsys, name+p.ext)
+		if err != nil || sibling.IsDir() {
+			continue
+		}
+		middleware.AddVary(c, igin.HeaderAcceptEncoding)
+		if servedName == name && acceptsEncoding(acceptEncoding, p.encoding) {
+			servedName, servedInfo, encoding = name+p.ext, sibling, p.encoding
+		}
+	}
+	content, err := s.open(servedName)
+	if err != nil {
+		return false
+	}
+	if closer, ok := content.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if encoding != "" {
+		header.Set(igin.HeaderContentEncoding, encoding)
+	}
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		header.Set(igin.HeaderContentType, contentType)
+	}
+	if s.config.Fingerprinted.MatchString(path.Base(name)) {
+		header.Set(igin.HeaderCacheControl, "public, max-age=31536000, immutable")
+	} else {
+		header.Set(igin.HeaderCacheControl, s.config.CacheControl)
+	}
+	if etag, err := s.etag(servedName, servedInfo); err == nil {
+		header.Set(igin.HeaderETag, etag)
+	}
+	http.ServeContent(c.Writer, c.Request, name, servedInfo.ModTime(), content)
+	c.Abort()
+	return true
+}
+
+// open returns a seekable reader of name, files not implementing io.Seeker are read into memory.
+func (s *Server) open(name string) (io.ReadSeeker, error) {
+	file, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if seeker, ok := file.(io.ReadSeeker); ok {
+		return seeker, nil
+	}
+	defer file.Close()
+	b, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
+
+// etag returns the strong ETag of name, hashes are cached until the size or the modification time change.
+func (s *Server) etag(name string, info fs.FileInfo) (string, error) {
+	key := etagKey{name: name, size: info.Size(), modTime: info.ModTime()}
+	if etag, ok := s.etags.Load(key); ok {
+		return etag.(string), nil
+	}
+	file, err := s.fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+	s.etags.Store(key, etag)
+	return etag, nil
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header value allows encoding.
+func acceptsEncoding(header, encoding string) bool {
+	accepted := false
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.TrimSpace(name)
+		if !strings.EqualFold(name, encoding) && name != "*" {
+			continue
+		}
+		q := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			if parsed, err := strconv.ParseFloat(params[2:], 64); err == nil {
+				q = parsed
+			}
+		}
+		if strings.EqualFold(name, encoding) {
+			return q > 0
+		}
+		accepted = q > 0
+	}
+	return accepted
+}
@@ -0,0 +1,74 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fsys := fstest.MapFS{
+		"dist/index.html":                {Data: []byte("<html>app</html>")},
+		"dist/assets/app.3f2a1b9c.js":    {Data: []byte("console.log('app')")},
+		"dist/assets/app.3f2a1b9c.js.br": {Data: []byte("brotli")},
+		"dist/assets/app.3f2a1b9c.js.gz": {Data: []byte("gzip")},
+		"dist/docs/index.html":           {Data: []byte("docs")},
+	}
+	e := igin.New()
+	e.GET("/api/users", func(c *gin.Context) {
+		c.String(http.StatusOK, "users")
+	})
+	e.NoRoute(New(Config{FS: fsys, Root: "dist", SPA: true}).Handler())
+
+	serve := func(target string, headers ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<html>app</html>", w.Body.String())
+	assert.Equal(t, "no-cache", w.Header().Get(igin.HeaderCacheControl))
+	etag := w.Header().Get(igin.HeaderETag)
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, http.StatusNotModified, serve("/", igin.HeaderIfNoneMatch, etag).Code)
+
+	assert.Equal(t, "<html>app</html>", serve("/users/1/edit").Body.String(), "unknown paths fall back to the index")
+	assert.Equal(t, "docs", serve("/docs/").Body.String())
+	assert.Equal(t, "users", serve("/api/users").Body.String())
+	assert.Equal(t, http.StatusNotFound, serve("/api/missing").Code)
+	assert.Equal(t, http.StatusNotFound, serve("/assets/missing.js").Code)
+
+	w = serve("/assets/app.3f2a1b9c.js", igin.HeaderAcceptEncoding, "gzip, br;q=0")
+	assert.Equal(t, "gzip", w.Body.String())
+	assert.Equal(t, "gzip", w.Header().Get(igin.HeaderContentEncoding))
+	assert.Contains(t, w.Header().Get(igin.HeaderContentType), "javascript")
+	assert.Equal(t, igin.HeaderAcceptEncoding, w.Header().Get(igin.HeaderVary))
+	assert.Equal(t, "public, max-age=31536000, immutable", w.Header().Get(igin.HeaderCacheControl))
+	assert.Equal(t, "brotli", serve("/assets/app.3f2a1b9c.js", igin.HeaderAcceptEncoding, "gzip, br").Body.String())
+
+	w = serve("/assets/app.3f2a1b9c.js", "Range", "bytes=0-6")
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "console", w.Body.String())
+	assert.Empty(t, w.Header().Get(igin.HeaderContentEncoding))
+
+	e = igin.New()
+	e.Plugin(New(Config{FS: fsys, Root: "dist", Path: "/static"}))
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/static/docs/index.html", nil))
+	assert.Equal(t, "docs", w.Body.String())
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/static/users", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "no fallback without SPA")
+}
@@ -1,6 +1,34 @@
 package middleware
 
-import "strings"
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+)
+
+// AddVary adds values to the Vary header of the response, keeping values set before and skipping duplicates.
+func AddVary(c *gin.Context, values ...string) {
+	header := c.Writer.Header()
+	existing := map[string]bool{}
+	for _, line := range header.Values(igin.HeaderVary) {
+		for _, v := range strings.Split(line, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				existing[http.CanonicalHeaderKey(v)] = true
+			}
+		}
+	}
+	for _, value := range values {
+		if key := http.CanonicalHeaderKey(value); !existing[key] && !existing["*"] {
+			existing[key] = true
+			header.Add(igin.HeaderVary, value)
+		}
+	}
+}
 
 func MatchScheme(domain, pattern string) bool {
 	didx := strings.Index(domain, ":")
@@ -48,3 +76,69 @@ func MatchSubdomain(domain, pattern string) bool {
 	}
 	return false
 }
+
+var rewriteGroupRegexp = regexp.MustCompile(`\$(\d+)`)
+
+type rewriteRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// compileRewrites compiles rules like "/old/*": "/new/$1", every "*" captures a group referenced as $1, $2...
+// Longer patterns are tried first.
+func compileRewrites(rules map[string]string) []rewriteRule {
+	patterns := make([]string, 0, len(rules))
+	for pattern := range rules {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+	compiled := make([]rewriteRule, 0, len(patterns))
+	for _, pattern := range patterns {
+		compiled = append(compiled, compileRewrite(wildcardRegexp(pattern), rules[pattern]))
+	}
+	return compiled
+}
+
+// wildcardRegexp compiles a path pattern where every "*" captures a group.
+func wildcardRegexp(pattern string) *regexp.Regexp {
+	return regexp.MustCompile("^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), "\\*", "(.*)") + "$")
+}
+
+// compileRewrite converts the $1, $2... references of replacement to the regexp expansion syntax.
+func compileRewrite(pattern *regexp.Regexp, replacement string) rewriteRule {
+	return rewriteRule{pattern: pattern, replacement: rewriteGroupRegexp.ReplaceAllString(replacement, "$${$1}")}
+}
+
+// rewritePath applies the first matching rule to path.
+func rewritePath(rules []rewriteRule, path string) (string, bool) {
+	for _, rule := range rules {
+		if rule.pattern.MatchString(path) {
+			return rule.pattern.ReplaceAllString(path, rule.replacement), true
+		}
+	}
+	return path, false
+}
+
+// rewriteURL applies the first matching rule to the path of u, a query in the replacement is merged
+// before the original query.
+func rewriteURL(rules []rewriteRule, u *url.URL) bool {
+	rewritten, ok := rewritePath(rules, u.Path)
+	if !ok {
+		return false
+	}
+	path, query, _ := strings.Cut(rewritten, "?")
+	u.Path = path
+	u.RawPath = ""
+	if query != "" {
+		if u.RawQuery != "" {
+			query += "&" + u.RawQuery
+		}
+		u.RawQuery = query
+	}
+	return true
+}
@@ -0,0 +1,477 @@
+package websocket
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin/middleware"
+	"github.com/pkg6/igin/xerror"
+)
+
+type (
+	// Config defines the config for Hub.
+	Config struct {
+		// Path is the route of the hub registered as plugin with igin.Engine.Plugin.
+		// Optional. Default value "".
+		Path string
+		// ErrorHandler defines a function which is executed for failed handshakes.
+		// Optional. Default value middleware.DefaultErrorHandler.
+		ErrorHandler middleware.ErrorHandler
+		// CheckOrigin allows the Origin of the handshake, reject other sites to prevent cross-site WebSocket hijacking.
+		// Optional. Default value SameOrigin.
+		CheckOrigin func(r *http.Request) bool
+		// Subprotocols supported, the first one offered by the client is selected.
+		// Optional.
+		Subprotocols []string
+		// ReadLimit is the maximum size of a received message.
+		// Optional. Default value 64KB.
+		ReadLimit int64
+		// SendQueue is the number of messages queued per connection, connections falling further behind are
+		// closed with CloseTryAgainLater.
+		// Optional. Default value 64.
+		SendQueue int
+		// WriteWait is the time allowed to write a message.
+		// Optional. Default value 10 seconds.
+		WriteWait time.Duration
+		// PongWait is the time allowed between pongs, idle connections are closed afterwards.
+		// Optional. Default value 60 seconds.
+		PongWait time.Duration
+		// PingInterval is the interval of pings, it must be shorter than PongWait.
+		// Optional. Default value 9/10 of PongWait.
+		PingInterval time.Duration
+		// OnConnect is called after the handshake, e.g. to join rooms. Returning an error closes the connection.
+		// Optional.
+		OnConnect func(client *Client) error
+		// OnDisconnect is called after the connection closed.
+		// Optional.
+		OnDisconnect func(client *Client)
+	}
+
+	// Hub manages the connections of a WebSocket endpoint, their rooms and the message routes.
+	Hub struct {
+		config   Config
+		mu       sync.RWMutex
+		clients  map[*Client]struct{}
+		rooms    map[string]map[*Client]struct{}
+		routes   map[string]HandlerFunc
+		closed   bool
+		handlers sync.WaitGroup
+	}
+
+	// Client is a connection of a Hub.
+	Client struct {
+		// ID identifies the connection.
+		ID string
+		// Context is a copy of the context of the handshake, it carries the values set by the middleware
+		// before the handler, e.g. the principal of the jwt or key auth middleware.
+		Context *gin.Context
+		// Conn is the underlying connection.
+		Conn      *Conn
+		hub       *Hub
+		send      chan outbound
+		rooms     map[string]struct{}
+		done      chan struct{}
+		once      sync.Once
+		closeCode int
+		closeText string
+	}
+
+	outbound struct {
+		messageType int
+		data        []byte
+	}
+)
+
+var (
+	// DefaultConfig is the default Hub config.
+	defaultConfig = Config{
+		ErrorHandler: middleware.DefaultErrorHandler,
+		CheckOrigin:  SameOrigin,
+		ReadLimit:    64 << 10,
+		SendQueue:    64,
+		WriteWait:    10 * time.Second,
+		PongWait:     60 * time.Second,
+	}
+	ErrHubClosed     = xerror.NewHTTPError(http.StatusServiceUnavailable, "websocket hub closed")
+	ErrSendQueueFull = errors.New("websocket: send queue full")
+)
+
+// NewHub returns a Hub with config.
+func NewHub(config Config) *Hub {
+	// Defaults
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = defaultConfig.ErrorHandler
+	}
+	if config.CheckOrigin == nil {
+		config.CheckOrigin = defaultConfig.CheckOrigin
+	}
+	if config.ReadLimit == 0 {
+		config.ReadLimit = defaultConfig.ReadLimit
+	}
+	if config.SendQueue == 0 {
+		config.SendQueue = defaultConfig.SendQueue
+	}
+	if config.WriteWait == 0 {
+		config.WriteWait = defaultConfig.WriteWait
+	}
+	if config.PongWait == 0 {
+		config.PongWait = defaultConfig.PongWait
+	}
+	if config.PingInterval == 0 {
+		config.PingInterval = config.PongWait * 9 / 10
+	}
+	if config.PingInterval >= config.PongWait {
+		panic("IGin: websocket ping interval must be shorter than pong wait")
+	}
+	return &Hub{
+		config:  config,
+		clients: map[*Client]struct{}{},
+		rooms:   map[string]map[*Client]struct{}{},
+		routes:  map[string]HandlerFunc{},
+	}
+}
+
+// Handler returns the handler upgrading requests to WebSocket connections, it returns when the connection closed.
+// Register it after the authentication middleware, their context values are available through Client.Context.
+func (h *Hub) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h.mu.Lock()
+		if h.closed {
+			h.mu.Unlock()
+			h.config.ErrorHandler(c, ErrHubClosed, ErrHubClosed.Code)
+			return
+		}
+		h.handlers.Add(1)
+		h.mu.Unlock()
+		defer h.handlers.Done()
+
+		conn, err := Upgrade(c.Writer, c.Request, h.config.CheckOrigin, h.config.Subprotocols...)
+		if err != nil {
+			code := http.StatusBadRequest
+			if errors.Is(err, ErrOriginForbidden) {
+				code = http.StatusForbidden
+			}
+			he := xerror.NewHTTPError(code, err.Error())
+			h.config.ErrorHandler(c, he, he.Code)
+			return
+		}
+		client := &Client{
+			ID:      newClientID(),
+			Context: c.Copy(),
+			Conn:    conn,
+			hub:     h,
+			send:    make(chan outbound, h.config.SendQueue),
+			rooms:   map[string]struct{}{},
+			done:    make(chan struct{}),
+		}
+		c.Abort()
+		h.serve(client)
+	}
+}
+
+// Broadcast sends a text message to all connections, or to the members of rooms when given.
+// Connections whose queue is full are closed.
+func (h *Hub) Broadcast(data []byte, rooms ...string) {
+	for _, client := range h.Clients(rooms...) {
+		_ = client.Send(data)
+	}
+}
+
+// BroadcastJSON sends a Message of typ with data to all connections, or to the members of rooms when given.
+func (h *Hub) BroadcastJSON(typ string, data any, rooms ...string) error {
+	message, err := newMessage(typ, data)
+	if err != nil {
+		return err
+	}
+	h.Broadcast(message, rooms...)
+	return nil
+}
+
+// Clients returns the connections, or the members of rooms when given.
+func (h *Hub) Clients(rooms ...string) []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var clients []*Client
+	if len(rooms) == 0 {
+		for client := range h.clients {
+			clients = append(clients, client)
+		}
+		return clients
+	}
+	seen := map[*Client]bool{}
+	for _, room := range rooms {
+		for client := range h.rooms[room] {
+			if !seen[client] {
+				seen[client] = true
+				clients = append(clients, client)
+			}
+		}
+	}
+	return clients
+}
+
+// Shutdown closes all connections with CloseGoingAway and waits for their handlers to return until ctx is done,
+// new handshakes are rejected. Call it from http.Server.RegisterOnShutdown, hijacked connections are not
+// closed by http.Server.Shutdown:
+//
+//	srv.RegisterOnShutdown(func() { _ = hub.Shutdown(context.Background()) })
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.closed = true
+	h.mu.Unlock()
+	for _, client := range h.Clients() {
+		client.Close(CloseGoingAway, "server shutdown")
+	}
+	done := make(chan struct{})
+	go func() {
+		h.handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		for _, client := range h.Clients() {
+			_ = client.Conn.Close()
+		}
+		return ctx.Err()
+	}
+}
+
+// RouterPath returns Config.Path. The Hub is an igin plugin, installed with igin.Engine.Plugin it is shut down
+// by igin.Engine.ClosePlugins:
+//
+//	e.Plugin(hub)
+//	srv.RegisterOnShutdown(func() { _ = e.ClosePlugins() })
+func (h *Hub) RouterPath() string {
+	return h.config.Path
+}
+
+// Register registers Handler for GET requests.
+func (h *Hub) Register(group *gin.RouterGroup) {
+	group.GET("", h.Handler())
+}
+
+// Close shuts the hub down and waits twice WriteWait for the handlers to return, see Shutdown.
+func (h *Hub) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*h.config.WriteWait)
+	defer cancel()
+	return h.Shutdown(ctx)
+}
+
+// serve runs the connection until it closes.
+func (h *Hub) serve(client *Client) {
+	h.mu.Lock()
+	h.clients[client] = struct{}{}
+	if h.closed {
+		// shut down during the handshake
+		client.Close(CloseGoingAway, "server shutdown")
+	}
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.clients, client)
+		for room := range client.rooms {
+			h.leave(client, room)
+		}
+		h.mu.Unlock()
+		_ = client.Conn.Close()
+		if h.config.OnDisconnect != nil {
+			h.config.OnDisconnect(client)
+		}
+	}()
+
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		client.writePump()
+	}()
+	defer func() { <-written }()
+
+	if h.config.OnConnect != nil {
+		if err := h.config.OnConnect(client); err != nil {
+			client.Close(ClosePolicyViolation, err.Error())
+		}
+	}
+	client.readPump()
+}
+
+// join adds client to room. h.mu must be held.
+func (h *Hub) join(client *Client, room string) {
+	if h.rooms[room] == nil {
+		h.rooms[room] = map[*Client]struct{}{}
+	}
+	h.rooms[room][client] = struct{}{}
+	client.rooms[room] = struct{}{}
+}
+
+// leave removes client from room. h.mu must be held.
+func (h *Hub) leave(client *Client, room string) {
+	delete(client.rooms, room)
+	if members, ok := h.rooms[room]; ok {
+		delete(members, client)
+		if len(members) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+}
+
+// Send queues a text message, it closes the connection with CloseTryAgainLater when the queue is full.
+func (c *Client) Send(data []byte) error {
+	return c.queue(outbound{messageType: TextMessage, data: data})
+}
+
+// SendBinary queues a binary message, it closes the connection with CloseTryAgainLater when the queue is full.
+func (c *Client) SendBinary(data []byte) error {
+	return c.queue(outbound{messageType: BinaryMessage, data: data})
+}
+
+// SendJSON queues a Message of typ with data.
+func (c *Client) SendJSON(typ string, data any) error {
+	message, err := newMessage(typ, data)
+	if err != nil {
+		return err
+	}
+	return c.Send(message)
+}
+
+// Join adds the connection to rooms, closed connections are not added.
+func (c *Client) Join(rooms ...string) {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	for _, room := range rooms {
+		c.hub.join(c, room)
+	}
+}
+
+// Leave removes the connection from rooms.
+func (c *Client) Leave(rooms ...string) {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	for _, room := range rooms {
+		c.hub.leave(c, room)
+	}
+}
+
+// Rooms returns the rooms the connection joined.
+func (c *Client) Rooms() []string {
+	c.hub.mu.RLock()
+	defer c.hub.mu.RUnlock()
+	rooms := make([]string, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+// Close closes the connection with code after the queued messages were written.
+func (c *Client) Close(code int, text string) {
+	c.once.Do(func() {
+		c.closeCode, c.closeText = code, text
+		close(c.done)
+	})
+}
+
+func (c *Client) queue(message outbound) error {
+	select {
+	case <-c.done:
+		return ErrCloseSent
+	default:
+	}
+	select {
+	case c.send <- message:
+		return nil
+	default:
+		c.Close(CloseTryAgainLater, "send queue full")
+		return ErrSendQueueFull
+	}
+}
+
+func (c *Client) readPump() {
+	config := c.hub.config
+	c.Conn.SetReadLimit(config.ReadLimit)
+	_ = c.Conn.SetReadDeadline(time.Now().Add(config.PongWait))
+	c.Conn.SetPongHandler(func(string) {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(config.PongWait))
+	})
+	for {
+		messageType, data, err := c.Conn.ReadMessage()
+		if err != nil {
+			c.Close(CloseNormalClosure, "")
+			return
+		}
+		if messageType != TextMessage {
+			c.Close(CloseUnsupportedData, "binary messages are not supported")
+			continue
+		}
+		c.hub.dispatch(c, data)
+	}
+}
+
+func (c *Client) writePump() {
+	config := c.hub.config
+	ticker := time.NewTicker(config.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case message := <-c.send:
+			_ = c.Conn.SetWriteDeadline(time.Now().Add(config.WriteWait))
+			if err := c.Conn.WriteMessage(message.messageType, message.data); err != nil {
+				c.Close(CloseNormalClosure, "")
+				_ = c.Conn.Close()
+				return
+			}
+		case <-ticker.C:
+			_ = c.Conn.SetWriteDeadline(time.Now().Add(config.WriteWait))
+			if err := c.Conn.WriteControl(PingMessage, nil); err != nil {
+				c.Close(CloseNormalClosure, "")
+				_ = c.Conn.Close()
+				return
+			}
+		case <-c.done:
+			// flush the queued messages, then wait for the close reply of the peer
+			for queued := len(c.send); queued > 0; queued-- {
+				message := <-c.send
+				_ = c.Conn.SetWriteDeadline(time.Now().Add(config.WriteWait))
+				if c.Conn.WriteMessage(message.messageType, message.data) != nil {
+					break
+				}
+			}
+			_ = c.Conn.SetWriteDeadline(time.Now().Add(config.WriteWait))
+			if c.Conn.WriteClose(c.closeCode, c.closeText) == nil {
+				_ = c.Conn.SetReadDeadline(time.Now().Add(config.WriteWait))
+			} else {
+				_ = c.Conn.Close()
+			}
+			return
+		}
+	}
+}
+
+func newClientID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func newMessage(typ string, data any) ([]byte, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Message{Type: typ, Data: raw})
+}
@@ -0,0 +1,81 @@
+package websocket
+
+import (
+	"encoding/json"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/pkg6/igin"
+)
+
+// ErrorMessageType is the type of the messages reporting failed messages to the client.
+const ErrorMessageType = "error"
+
+type (
+	// Message is the envelope of the JSON messages routed by the Hub, e.g. {"type":"chat.send","data":{...}}.
+	Message struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data,omitempty"`
+	}
+
+	// HandlerFunc handles the messages of a type, a returned error is sent to the client as ErrorMessage.
+	HandlerFunc func(client *Client, message Message) error
+
+	// ErrorMessage is the data of ErrorMessageType messages.
+	ErrorMessage struct {
+		// Type of the failed message.
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	}
+)
+
+// Handle registers handler for the messages of typ.
+func (h *Hub) Handle(typ string, handler HandlerFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.routes[typ] = handler
+}
+
+// On registers handler for the messages of typ, their data is decoded into T and validated with binding.Validator,
+// validation messages are translated by igin.Translator when it is set.
+//
+//	websocket.On(hub, "chat.send", func(client *websocket.Client, msg ChatMessage) error {
+//		return hub.BroadcastJSON("chat.message", msg, msg.Room)
+//	})
+func On[T any](h *Hub, typ string, handler func(client *Client, data T) error) {
+	h.Handle(typ, func(client *Client, message Message) error {
+		var data T
+		if len(message.Data) > 0 {
+			if err := json.Unmarshal(message.Data, &data); err != nil {
+				return err
+			}
+		}
+		if binding.Validator != nil {
+			if err := binding.Validator.ValidateStruct(data); err != nil {
+				if igin.Translator != nil {
+					err = igin.Translator.ValidateError(err)
+				}
+				return err
+			}
+		}
+		return handler(client, data)
+	})
+}
+
+// dispatch routes a received text message.
+func (h *Hub) dispatch(client *Client, data []byte) {
+	var message Message
+	if err := json.Unmarshal(data, &message); err != nil {
+		_ = client.SendJSON(ErrorMessageType, ErrorMessage{Message: "invalid message"})
+		return
+	}
+	h.mu.RLock()
+	handler, ok := h.routes[message.Type]
+	h.mu.RUnlock()
+	if !ok {
+		_ = client.SendJSON(ErrorMessageType, ErrorMessage{Type: message.Type, Message: "unknown message type"})
+		return
+	}
+	if err := handler(client, message); err != nil {
+		_ = client.SendJSON(ErrorMessageType, ErrorMessage{Type: message.Type, Message: err.Error()})
+	}
+}
@@ -0,0 +1,207 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg6/igin"
+	"github.com/stretchr/testify/assert"
+)
+
+type testClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dial(t *testing.T, server *httptest.Server, path string) *testClient {
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	assert.NoError(t, err)
+	_, _ = conn.Write([]byte("GET " + path + " HTTP/1.1\r\nHost: " + server.Listener.Addr().String() +
+		"\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n"))
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+	return &testClient{conn: conn, br: br}
+}
+
+func (c *testClient) write(opcode int, payload []byte) {
+	frame := []byte{0x80 | byte(opcode), 0x80 | byte(len(payload)), 1, 2, 3, 4}
+	for i, b := range payload {
+		frame = append(frame, b^frame[2+i%4])
+	}
+	_, _ = c.conn.Write(frame)
+}
+
+func (c *testClient) read(t *testing.T) (int, []byte) {
+	_ = c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	header := make([]byte, 2)
+	_, err := io.ReadFull(c.br, header)
+	assert.NoError(t, err)
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		ext := make([]byte, 2)
+		_, _ = io.ReadFull(c.br, ext)
+		length = int(binary.BigEndian.Uint16(ext))
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(c.br, payload)
+	assert.NoError(t, err)
+	return int(header[0] & 0x0f), payload
+}
+
+func (c *testClient) readMessage(t *testing.T) Message {
+	opcode, payload := c.read(t)
+	assert.Equal(t, TextMessage, opcode)
+	var message Message
+	assert.NoError(t, json.Unmarshal(payload, &message))
+	return message
+}
+
+type chatMessage struct {
+	Room string `json:"room" binding:"required"`
+	Text string `json:"text"`
+}
+
+func TestHub(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := NewHub(Config{
+		OnConnect: func(client *Client) error {
+			client.Join("lobby")
+			return nil
+		},
+	})
+	On(hub, "chat.send", func(client *Client, msg chatMessage) error {
+		msg.Text = client.Context.GetString("user") + ": " + msg.Text
+		return hub.BroadcastJSON("chat.message", msg, msg.Room)
+	})
+	g := gin.New()
+	g.GET("/ws", func(c *gin.Context) {
+		c.Set("user", c.Query("user"))
+	}, hub.Handler())
+	server := httptest.NewServer(g)
+	defer server.Close()
+
+	alice := dial(t, server, "/ws?user=alice")
+	bob := dial(t, server, "/ws?user=bob")
+	assert.Eventually(t, func() bool {
+		return len(hub.Clients("lobby")) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	alice.write(TextMessage, []byte(`{"type":"chat.send","data":{"room":"lobby","text":"hi"}}`))
+	for _, client := range []*testClient{alice, bob} {
+		message := client.readMessage(t)
+		assert.Equal(t, "chat.message", message.Type)
+		assert.JSONEq(t, `{"room":"lobby","text":"alice: hi"}`, string(message.Data))
+	}
+
+	bob.write(TextMessage, []byte(`{"type":"chat.send","data":{"text":"no room"}}`))
+	message := bob.readMessage(t)
+	assert.Equal(t, ErrorMessageType, message.Type)
+	assert.Contains(t, string(message.Data), "Room")
+	bob.write(TextMessage, []byte(`{"type":"unknown"}`))
+	assert.JSONEq(t, `{"type":"unknown","message":"unknown message type"}`, string(bob.readMessage(t).Data))
+
+	bob.write(PingMessage, []byte("p"))
+	opcode, payload := bob.read(t)
+	assert.Equal(t, PongMessage, opcode)
+	assert.Equal(t, "p", string(payload))
+
+	bob.write(CloseMessage, []byte{0x03, 0xe8})
+	opcode, _ = bob.read(t)
+	assert.Equal(t, CloseMessage, opcode)
+	assert.Eventually(t, func() bool {
+		return len(hub.Clients()) == 1
+	}, time.Second, 10*time.Millisecond, "closed connections leave the hub")
+
+	done := make(chan error)
+	go func() {
+		done <- hub.Shutdown(context.Background())
+	}()
+	opcode, payload = alice.read(t)
+	assert.Equal(t, CloseMessage, opcode)
+	assert.Equal(t, CloseGoingAway, int(binary.BigEndian.Uint16(payload)))
+	alice.write(CloseMessage, payload[:2])
+	assert.NoError(t, <-done)
+
+	resp, err := http.Get(server.URL + "/ws")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestUpgradeRejected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.GET("/ws", NewHub(Config{}).Handler())
+	server := httptest.NewServer(g)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/ws")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/ws", nil)
+	for name, value := range map[string]string{
+		"Connection":            "Upgrade",
+		"Upgrade":               "websocket",
+		"Sec-WebSocket-Version": "13",
+		"Sec-WebSocket-Key":     "dGhlIHNhbXBsZSBub25jZQ==",
+		"Origin":                "https://evil.example.com",
+	} {
+		req.Header.Set(name, value)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.False(t, strings.Contains(resp.Header.Get("Upgrade"), "websocket"))
+}
+
+func TestHubPlugin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	disconnected := make(chan *Client, 1)
+	hub := NewHub(Config{
+		Path: "/ws",
+		OnDisconnect: func(client *Client) {
+			disconnected <- client
+		},
+	})
+	e := igin.New()
+	e.Plugin(hub)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	alice := dial(t, server, "/ws")
+	assert.Eventually(t, func() bool {
+		return len(hub.Clients()) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	done := make(chan error)
+	go func() {
+		done <- e.ClosePlugins()
+	}()
+	opcode, payload := alice.read(t)
+	assert.Equal(t, CloseMessage, opcode)
+	assert.Equal(t, CloseGoingAway, int(binary.BigEndian.Uint16(payload)))
+	alice.write(CloseMessage, payload[:2])
+	assert.NoError(t, <-done)
+
+	client := <-disconnected
+	client.Join("lobby")
+	assert.Empty(t, hub.Clients("lobby"), "closed connections do not join rooms")
+	assert.Empty(t, client.Rooms())
+}
@@ -0,0 +1,202 @@
+package igin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The extended plugin contract, every part is optional. Plugins without Name are named after their type.
+type (
+	// INamedPlugin names a plugin, the name is used for dependencies and configuration and must be unique.
+	INamedPlugin interface {
+		Name() string
+	}
+	// IPluginDependencies lists the names of the plugins which must be registered before the plugin.
+	IPluginDependencies interface {
+		Dependencies() []string
+	}
+	// IPluginInit is initialized with its configuration before it is registered.
+	IPluginInit interface {
+		Init(config PluginConfig) error
+	}
+	// IPluginClose releases the resources of the plugin, see Engine.ClosePlugins.
+	IPluginClose interface {
+		Close() error
+	}
+)
+
+type (
+	// PluginsConfig configures plugins by name, e.g. loaded from the configuration file of the application.
+	PluginsConfig map[string]PluginConfig
+
+	// PluginConfig configures a plugin.
+	PluginConfig struct {
+		// Disabled plugins are not initialized nor registered.
+		Disabled bool `json:"disabled" yaml:"disabled"`
+		// Settings are passed to IPluginInit.
+		Settings map[string]any `json:"settings" yaml:"settings"`
+	}
+
+	// PluginInfo describes an installed plugin.
+	PluginInfo struct {
+		Name         string
+		Path         string
+		Dependencies []string
+		Enabled      bool
+		// Routes registered by the plugin.
+		Routes []gin.RouteInfo
+	}
+
+	installedPlugin struct {
+		plugin IPlugin
+		info   PluginInfo
+	}
+)
+
+// ConfigurePlugins sets the configuration of the plugins registered afterwards.
+func (e *Engine) ConfigurePlugins(config PluginsConfig) *Engine {
+	e.pluginsConfig = config
+	return e
+}
+
+// Plugin registers plugins under their RouterPath with their IMiddleware.
+//
+// Plugins are registered after their dependencies, which are registered before or passed in the same call.
+// Disabled plugins are skipped, IPluginInit is called with the configuration of the plugin before Register.
+// It panics on unknown or disabled dependencies, dependency cycles, duplicate names and Init errors.
+func (e *Engine) Plugin(Plugins ...IPlugin) {
+	// plugins are tracked by index, plugin values are not necessarily comparable
+	byName := map[string]int{}
+	for i, p := range Plugins {
+		name := PluginName(p)
+		if _, ok := p.(INamedPlugin); ok {
+			if _, exists := byName[name]; exists || e.installedPlugin(name) != nil {
+				panic("IGin: duplicate plugin " + name)
+			}
+		}
+		if _, exists := byName[name]; !exists {
+			byName[name] = i
+		}
+	}
+	var ordered []IPlugin
+	state := make([]int, len(Plugins)) // 1 visiting, 2 done
+	var visit func(i int, path []string)
+	visit = func(i int, path []string) {
+		p := Plugins[i]
+		name := PluginName(p)
+		switch state[i] {
+		case 1:
+			panic("IGin: plugin dependency cycle " + strings.Join(append(path, name), " -> "))
+		case 2:
+			return
+		}
+		state[i] = 1
+		for _, dependency := range pluginDependencies(p) {
+			if installed := e.installedPlugin(dependency); installed != nil {
+				if !installed.info.Enabled && !e.pluginsConfig[name].Disabled {
+					panic(fmt.Sprintf("IGin: plugin %s depends on disabled plugin %s", name, dependency))
+				}
+				continue
+			}
+			d, ok := byName[dependency]
+			if !ok {
+				panic(fmt.Sprintf("IGin: plugin %s depends on unknown plugin %s", name, dependency))
+			}
+			if e.pluginsConfig[dependency].Disabled && !e.pluginsConfig[name].Disabled {
+				panic(fmt.Sprintf("IGin: plugin %s depends on disabled plugin %s", name, dependency))
+			}
+			visit(d, append(path, name))
+		}
+		state[i] = 2
+		ordered = append(ordered, p)
+	}
+	for i := range Plugins {
+		visit(i, nil)
+	}
+
+	group := e.Group("")
+	for _, p := range ordered {
+		name := PluginName(p)
+		config := e.pluginsConfig[name]
+		installed := &installedPlugin{plugin: p, info: PluginInfo{
+			Name:         name,
+			Path:         p.RouterPath(),
+			Dependencies: pluginDependencies(p),
+			Enabled:      !config.Disabled,
+		}}
+		e.plugins = append(e.plugins, installed)
+		if config.Disabled {
+			continue
+		}
+		if i, ok := p.(IPluginInit); ok {
+			if err := i.Init(config); err != nil {
+				panic(fmt.Sprintf("IGin: plugin %s init: %v", name, err))
+			}
+		}
+		existing := map[string]bool{}
+		for _, route := range e.Routes() {
+			existing[route.Method+" "+route.Path] = true
+		}
+		var middleware []gin.HandlerFunc
+		if m, ok := p.(IMiddleware); ok {
+			middleware = m.Middleware()
+		}
+		PluginGroup := group.Group(p.RouterPath(), middleware...)
+		p.Register(PluginGroup)
+		for _, route := range e.Routes() {
+			if !existing[route.Method+" "+route.Path] {
+				installed.info.Routes = append(installed.info.Routes, route)
+			}
+		}
+	}
+}
+
+// Plugins returns the installed plugins in registration order, including the disabled ones.
+func (e *Engine) Plugins() []PluginInfo {
+	infos := make([]PluginInfo, len(e.plugins))
+	for i, installed := range e.plugins {
+		infos[i] = installed.info
+	}
+	return infos
+}
+
+// ClosePlugins closes the enabled IPluginClose plugins in reverse registration order, so plugins are closed
+// before their dependencies. All plugins are closed, the first error is returned.
+func (e *Engine) ClosePlugins() error {
+	var first error
+	for i := len(e.plugins) - 1; i >= 0; i-- {
+		installed := e.plugins[i]
+		if c, ok := installed.plugin.(IPluginClose); ok && installed.info.Enabled {
+			if err := c.Close(); err != nil && first == nil {
+				first = fmt.Errorf("IGin: plugin %s close: %w", installed.info.Name, err)
+			}
+		}
+	}
+	return first
+}
+
+// PluginName returns the name of p, its Name or its type.
+func PluginName(p IPlugin) string {
+	if n, ok := p.(INamedPlugin); ok {
+		return n.Name()
+	}
+	return fmt.Sprintf("%T", p)
+}
+
+func (e *Engine) installedPlugin(name string) *installedPlugin {
+	for _, installed := range e.plugins {
+		if installed.info.Name == name {
+			return installed
+		}
+	}
+	return nil
+}
+
+func pluginDependencies(p IPlugin) []string {
+	if d, ok := p.(IPluginDependencies); ok {
+		return d.Dependencies()
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package igin
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type lifecyclePlugin struct {
+	name         string
+	dependencies []string
+	events       *[]string
+	settings     map[string]any
+	closeErr     error
+}
+
+func (p *lifecyclePlugin) Name() string           { return p.name }
+func (p *lifecyclePlugin) RouterPath() string     { return "/" + p.name }
+func (p *lifecyclePlugin) Dependencies() []string { return p.dependencies }
+func (p *lifecyclePlugin) Init(config PluginConfig) error {
+	p.settings = config.Settings
+	*p.events = append(*p.events, "init "+p.name)
+	return nil
+}
+func (p *lifecyclePlugin) Register(group *gin.RouterGroup) {
+	*p.events = append(*p.events, "register "+p.name)
+	group.GET("", func(c *gin.Context) {
+		c.String(http.StatusOK, p.name)
+	})
+}
+func (p *lifecyclePlugin) Close() error {
+	*p.events = append(*p.events, "close "+p.name)
+	return p.closeErr
+}
+
+// valuePlugin is not comparable, it can not be a map key.
+type valuePlugin struct {
+	paths []string
+}
+
+func (valuePlugin) RouterPath() string { return "/value" }
+func (p valuePlugin) Register(group *gin.RouterGroup) {
+	for _, path := range p.paths {
+		group.GET(path, traced(path))
+	}
+}
+
+func TestEnginePlugin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var events []string
+	plugin := func(name string, dependencies ...string) *lifecyclePlugin {
+		return &lifecyclePlugin{name: name, dependencies: dependencies, events: &events}
+	}
+	e := New()
+	e.ConfigurePlugins(PluginsConfig{
+		"db":      {Settings: map[string]any{"dsn": "memory"}},
+		"metrics": {Disabled: true},
+	})
+	api, db, auth, metrics := plugin("api", "auth", "db"), plugin("db"), plugin("auth", "db"), plugin("metrics")
+	metrics.closeErr = errors.New("unexpected")
+	e.Plugin(api, metrics, auth, db)
+	e.Plugin(tracedPlugin{})
+
+	assert.Equal(t, []string{"init db", "register db", "init auth", "register auth", "init api", "register api"}, events,
+		"dependencies first, disabled plugins are skipped")
+	assert.Equal(t, map[string]any{"dsn": "memory"}, db.settings)
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api", nil))
+	assert.Equal(t, "api", w.Body.String())
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	infos := e.Plugins()
+	if assert.Len(t, infos, 5) {
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name)
+		}
+		assert.Equal(t, []string{"db", "auth", "api", "metrics", "igin.tracedPlugin"}, names)
+		assert.Equal(t, []string{"auth", "db"}, infos[2].Dependencies)
+		if assert.Len(t, infos[2].Routes, 1) {
+			assert.Equal(t, "/api", infos[2].Routes[0].Path)
+		}
+		assert.False(t, infos[3].Enabled)
+		assert.Empty(t, infos[3].Routes)
+		assert.Equal(t, "/plugin", infos[4].Routes[0].Path)
+	}
+
+	events = nil
+	assert.NoError(t, e.ClosePlugins())
+	assert.Equal(t, []string{"close api", "close auth", "close db"}, events, "reverse order, disabled plugins are not closed")
+	db.closeErr = errors.New("busy")
+	assert.EqualError(t, e.ClosePlugins(), "IGin: plugin db close: busy")
+
+	e.Plugin(plugin("admin", "auth"))
+	assert.Equal(t, "admin", e.Plugins()[5].Name, "dependencies may be installed before")
+}
+
+func TestEnginePluginPanics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var events []string
+	plugin := func(name string, dependencies ...string) *lifecyclePlugin {
+		return &lifecyclePlugin{name: name, dependencies: dependencies, events: &events}
+	}
+	assert.PanicsWithValue(t, "IGin: plugin dependency cycle a -> b -> c -> a", func() {
+		New().Plugin(plugin("a", "b"), plugin("b", "c"), plugin("c", "a"))
+	})
+	assert.PanicsWithValue(t, "IGin: plugin a depends on unknown plugin b", func() {
+		New().Plugin(plugin("a", "b"))
+	})
+	assert.PanicsWithValue(t, "IGin: duplicate plugin a", func() {
+		New().Plugin(plugin("a"), plugin("a"))
+	})
+	assert.PanicsWithValue(t, "IGin: plugin a depends on disabled plugin b", func() {
+		New().ConfigurePlugins(PluginsConfig{"b": {Disabled: true}}).Plugin(plugin("a", "b"), plugin("b"))
+	})
+	assert.NotPanics(t, func() {
+		New().ConfigurePlugins(PluginsConfig{"a": {Disabled: true}, "b": {Disabled: true}}).Plugin(plugin("a", "b"), plugin("b"))
+	}, "disabled plugins may depend on disabled plugins")
+}
+
+func TestEnginePluginValue(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := New()
+	assert.NotPanics(t, func() {
+		e.Plugin(valuePlugin{paths: []string{"/a"}}, valuePlugin{paths: []string{"/b"}})
+	})
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/value/b", nil))
+	assert.Equal(t, "/b", w.Body.String())
+	if infos := e.Plugins(); assert.Len(t, infos, 2) {
+		assert.Equal(t, "igin.valuePlugin", infos[0].Name)
+		assert.Equal(t, "/value/a", infos[0].Routes[0].Path)
+	}
+}
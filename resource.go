@@ -0,0 +1,164 @@
+package igin
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Resource actions, the names passed to IResourceActionMiddleware.
+const (
+	ResourceActionIndex   = "index"
+	ResourceActionShow    = "show"
+	ResourceActionCreate  = "create"
+	ResourceActionUpdate  = "update"
+	ResourceActionPatch   = "patch"
+	ResourceActionDestroy = "destroy"
+)
+
+type (
+	// IResourceController is a controller implementing any of the resource action interfaces,
+	// the actions it implements are routed by Engine.Resource.
+	IResourceController interface{}
+
+	// IResourceIndex lists the resources, GET /path.
+	IResourceIndex interface {
+		Index(c *gin.Context)
+	}
+	// IResourceShow shows a resource, GET /path/:id.
+	IResourceShow interface {
+		Show(c *gin.Context)
+	}
+	// IResourceCreate creates a resource, POST /path.
+	IResourceCreate interface {
+		Create(c *gin.Context)
+	}
+	// IResourceUpdate replaces a resource, PUT /path/:id.
+	IResourceUpdate interface {
+		Update(c *gin.Context)
+	}
+	// IResourcePatch partially updates a resource, PATCH /path/:id.
+	IResourcePatch interface {
+		Patch(c *gin.Context)
+	}
+	// IResourceDestroy deletes a resource, DELETE /path/:id.
+	IResourceDestroy interface {
+		Destroy(c *gin.Context)
+	}
+
+	// IResourceParam names the id param of the member routes, the default is "id".
+	// Parent resources of nested resources name it after themselves, gin requires the same param name
+	// at the same position: /users/:user_id and /users/:user_id/posts/:id.
+	IResourceParam interface {
+		ResourceParam() string
+	}
+	// IResourceActionMiddleware returns the middleware of an action, e.g. authentication for create only.
+	IResourceActionMiddleware interface {
+		ActionMiddleware(action string) []gin.HandlerFunc
+	}
+)
+
+type resourceAction struct {
+	name    string
+	method  string
+	member  bool
+	handler func(ctrl IResourceController) (gin.HandlerFunc, bool)
+}
+
+var resourceActions = []resourceAction{
+	{ResourceActionIndex, http.MethodGet, false, func(ctrl IResourceController) (gin.HandlerFunc, bool) {
+		a, ok := ctrl.(IResourceIndex)
+		if !ok {
+			return nil, false
+		}
+		return a.Index, true
+	}},
+	{ResourceActionCreate, http.MethodPost, false, func(ctrl IResourceController) (gin.HandlerFunc, bool) {
+		a, ok := ctrl.(IResourceCreate)
+		if !ok {
+			return nil, false
+		}
+		return a.Create, true
+	}},
+	{ResourceActionShow, http.MethodGet, true, func(ctrl IResourceController) (gin.HandlerFunc, bool) {
+		a, ok := ctrl.(IResourceShow)
+		if !ok {
+			return nil, false
+		}
+		return a.Show, true
+	}},
+	{ResourceActionUpdate, http.MethodPut, true, func(ctrl IResourceController) (gin.HandlerFunc, bool) {
+		a, ok := ctrl.(IResourceUpdate)
+		if !ok {
+			return nil, false
+		}
+		return a.Update, true
+	}},
+	{ResourceActionPatch, http.MethodPatch, true, func(ctrl IResourceController) (gin.HandlerFunc, bool) {
+		a, ok := ctrl.(IResourcePatch)
+		if !ok {
+			return nil, false
+		}
+		return a.Patch, true
+	}},
+	{ResourceActionDestroy, http.MethodDelete, true, func(ctrl IResourceController) (gin.HandlerFunc, bool) {
+		a, ok := ctrl.(IResourceDestroy)
+		if !ok {
+			return nil, false
+		}
+		return a.Destroy, true
+	}},
+}
+
+// Resource routes the actions ctrl implements under path, see Resource.
+func (e *Engine) Resource(path string, ctrl IResourceController) *gin.RouterGroup {
+	return Resource(&e.Engine.RouterGroup, path, ctrl)
+}
+
+// Resource routes the actions ctrl implements under path of group:
+//
+//	GET    /path      Index
+//	POST   /path      Create
+//	GET    /path/:id  Show
+//	PUT    /path/:id  Update
+//	PATCH  /path/:id  Patch
+//	DELETE /path/:id  Destroy
+//
+// path may contain the params of parent resources, e.g. "/users/:user_id/posts". IMiddleware runs
+// before IResourceActionMiddleware. It returns the group of path for additional routes, it panics when ctrl
+// implements no action.
+func Resource(group *gin.RouterGroup, path string, ctrl IResourceController) *gin.RouterGroup {
+	param := "id"
+	if p, ok := ctrl.(IResourceParam); ok {
+		param = p.ResourceParam()
+	}
+	var middleware []gin.HandlerFunc
+	if m, ok := ctrl.(IMiddleware); ok {
+		middleware = m.Middleware()
+	}
+	rg := group.Group(path, middleware...)
+	routed := false
+	for _, action := range resourceActions {
+		handler, ok := action.handler(ctrl)
+		if !ok {
+			continue
+		}
+		var handlers []gin.HandlerFunc
+		if m, ok := ctrl.(IResourceActionMiddleware); ok {
+			handlers = append(handlers, m.ActionMiddleware(action.name)...)
+		}
+		handlers = append(handlers, handler)
+		relativePath := ""
+		if action.member {
+			relativePath = "/:" + param
+		}
+		rg.Handle(action.method, relativePath, handlers...)
+		routed = true
+	}
+	if !routed {
+		panic(fmt.Sprintf("IGin: resource %s implements no action", strings.TrimSuffix(path, "/")))
+	}
+	return rg
+}
@@ -0,0 +1,78 @@
+package igin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type userResource struct{}
+
+func (userResource) ResourceParam() string { return "user_id" }
+func (userResource) Index(c *gin.Context)  { c.String(http.StatusOK, "users") }
+func (userResource) Show(c *gin.Context)   { c.String(http.StatusOK, "user "+c.Param("user_id")) }
+func (userResource) Destroy(c *gin.Context) {
+	c.String(http.StatusOK, "deleted "+c.Param("user_id"))
+}
+func (userResource) ActionMiddleware(action string) []gin.HandlerFunc {
+	if action != ResourceActionDestroy {
+		return nil
+	}
+	return []gin.HandlerFunc{func(c *gin.Context) {
+		if c.GetHeader(HeaderAuthorization) == "" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+		}
+	}}
+}
+
+type postResource struct{}
+
+func (postResource) Create(c *gin.Context) {
+	c.String(http.StatusCreated, "post of "+c.Param("user_id"))
+}
+func (postResource) Update(c *gin.Context) {
+	c.String(http.StatusOK, "put "+c.Param("user_id")+"/"+c.Param("id"))
+}
+func (postResource) Patch(c *gin.Context) {
+	c.String(http.StatusOK, "patch "+c.Param("user_id")+"/"+c.Param("id"))
+}
+
+func TestEngineResource(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := New()
+	users := e.Resource("/users", userResource{})
+	users.GET("/me", func(c *gin.Context) {
+		c.String(http.StatusOK, "me")
+	})
+	e.Resource("/users/:user_id/posts", postResource{})
+
+	serve := func(method, path string, headers ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, "users", serve(http.MethodGet, "/users").Body.String())
+	assert.Equal(t, "user 1", serve(http.MethodGet, "/users/1").Body.String())
+	assert.Equal(t, "me", serve(http.MethodGet, "/users/me").Body.String())
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodDelete, "/users/1").Code)
+	assert.Equal(t, "deleted 1", serve(http.MethodDelete, "/users/1", HeaderAuthorization, "Bearer t").Body.String())
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, "/users").Code, "actions not implemented are not routed")
+
+	w := serve(http.MethodPost, "/users/1/posts")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "post of 1", w.Body.String())
+	assert.Equal(t, "put 1/2", serve(http.MethodPut, "/users/1/posts/2").Body.String())
+	assert.Equal(t, "patch 1/2", serve(http.MethodPatch, "/users/1/posts/2").Body.String())
+
+	assert.Panics(t, func() {
+		e.Resource("/empty", struct{}{})
+	})
+}
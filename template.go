@@ -1,13 +1,108 @@
 package igin
 
 import (
+	"bytes"
+	"errors"
 	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
 )
 
+// ContextFunc returns a template function bound to the request being rendered, e.g. flash messages or csrf tokens.
+// Register it with Engine.SetFuncMaps like any other template function, it is bound when templates are
+// rendered with c.HTML.
+type ContextFunc func(c *gin.Context) any
+
 var (
 	defaultTemplateFuncMaps = template.FuncMap{
 		"raw": func(str string) template.HTML {
 			return template.HTML(str)
 		},
 	}
+	errContextFuncs = errors.New("IGin: context template functions require templates loaded through igin.Engine")
 )
+
+type (
+	// contextWriter carries the context to the HTML render.
+	contextWriter struct {
+		gin.ResponseWriter
+		c *gin.Context
+	}
+
+	// contextHTMLRender binds the context funcs of every rendered template.
+	contextHTMLRender struct {
+		render.HTMLRender
+		// pristine is a never executed copy of the production template, executed templates can not be cloned.
+		pristine *template.Template
+		funcs    map[string]ContextFunc
+	}
+
+	contextHTML struct {
+		render.HTML
+		funcs map[string]ContextFunc
+	}
+)
+
+func (w *contextWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func contextWriterNext(c *gin.Context) {
+	c.Writer = &contextWriter{ResponseWriter: c.Writer, c: c}
+	c.Next()
+}
+
+func (r *contextHTMLRender) Instance(name string, data any) render.Render {
+	instance := r.HTMLRender.Instance(name, data)
+	html, ok := instance.(render.HTML)
+	if !ok {
+		return instance
+	}
+	if r.pristine != nil {
+		html.Template = r.pristine
+	}
+	return &contextHTML{HTML: html, funcs: r.funcs}
+}
+
+// Render executes a clone of the template with the context funcs bound to the request.
+func (r *contextHTML) Render(w http.ResponseWriter) error {
+	var c *gin.Context
+	for unwrapped := w; unwrapped != nil; {
+		if cw, ok := unwrapped.(*contextWriter); ok {
+			c = cw.c
+			break
+		}
+		u, ok := unwrapped.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		unwrapped = u.Unwrap()
+	}
+	if c == nil {
+		return errContextFuncs
+	}
+	t, err := r.Template.Clone()
+	if err != nil {
+		return err
+	}
+	funcs := make(template.FuncMap, len(r.funcs))
+	for name, fn := range r.funcs {
+		funcs[name] = fn(c)
+	}
+	// render into a buffer, context funcs may still set headers like cookies
+	var buf bytes.Buffer
+	t = t.Funcs(funcs)
+	if r.Name == "" {
+		err = t.Execute(&buf, r.Data)
+	} else {
+		err = t.ExecuteTemplate(&buf, r.Name, r.Data)
+	}
+	if err != nil {
+		return err
+	}
+	r.WriteContentType(w)
+	_, err = buf.WriteTo(w)
+	return err
+}